@@ -1,17 +1,21 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/SimonRichardson/foodhygiene/pkg/query"
+	"github.com/SimonRichardson/foodhygiene/pkg/search"
 	"github.com/SimonRichardson/foodhygiene/pkg/service"
 	"github.com/SimonRichardson/foodhygiene/pkg/ui"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -24,7 +28,33 @@ const (
 )
 
 const (
-	defaultCache = true
+	defaultServiceRetries    = 3
+	defaultServiceBackoff    = 100 * time.Millisecond
+	defaultServiceBackoffMax = 5 * time.Second
+	defaultBreakerFailures   = 5
+	defaultBreakerCooldown   = 30 * time.Second
+	defaultServiceRate       = 10
+	defaultServiceBurst      = 20
+	defaultServicePageSize   = 500
+	defaultServicePages      = 4
+)
+
+const (
+	defaultCache                  = true
+	defaultCacheAuthoritiesTTL    = 24 * time.Hour
+	defaultCacheEstablishmentsTTL = time.Hour
+	defaultCacheStale             = 24 * time.Hour
+	defaultCacheDirTTL            = 24 * time.Hour
+	defaultCacheWarmWorkers       = 4
+	defaultCacheMaxEntries        = 100
+	defaultCacheMaxBytes          = 64 << 20
+)
+
+const (
+	defaultSearch               = true
+	defaultSearchMax            = 200000
+	defaultAggregateConcurrency = 4
+	defaultRankingsSnapshot     = 6 * time.Hour
 )
 
 // runQuery creates all the dependencies required to create and run the query
@@ -37,6 +67,31 @@ func runQuery(args []string) error {
 		apiAddr = flagset.String("api", defaultAPIAddr, "listen address for ingest and store APIs")
 		cache   = flagset.Bool("cache", defaultCache, "use cached results for better responsiveness")
 		uiLocal = flagset.Bool("ui.local", false, "Ignores embedded files and goes straight to the filesystem")
+
+		serviceRetries    = flagset.Int("service.retries", defaultServiceRetries, "number of times a temporarily failed request to the ratings API is retried")
+		serviceBackoff    = flagset.Duration("service.backoff", defaultServiceBackoff, "base duration of the exponential backoff between retries")
+		serviceBackoffMax = flagset.Duration("service.backoff.max", defaultServiceBackoffMax, "maximum duration to wait between retries")
+		servicePageSize   = flagset.Int("service.page.size", defaultServicePageSize, "number of establishments requested per page (0 requests everything at once)")
+		servicePages      = flagset.Int("service.page.concurrency", defaultServicePages, "number of pages requested concurrently")
+		serviceRate       = flagset.Float64("service.rate", defaultServiceRate, "maximum HTTP requests per second to the ratings API, counting every page and retry (0 unlimited)")
+		serviceBurst      = flagset.Int("service.burst", defaultServiceBurst, "maximum burst of requests to the ratings API")
+		breakerFailures   = flagset.Int("service.breaker.failures", defaultBreakerFailures, "consecutive failures before failing fast (0 disabled)")
+		breakerCooldown   = flagset.Duration("service.breaker.cooldown", defaultBreakerCooldown, "how long to fail fast before probing the ratings API again")
+
+		cacheAuthoritiesTTL    = flagset.Duration("cache.authorities.ttl", defaultCacheAuthoritiesTTL, "how long cached authorities live for (0 never expires)")
+		cacheEstablishmentsTTL = flagset.Duration("cache.establishments.ttl", defaultCacheEstablishmentsTTL, "how long cached establishments live for (0 never expires)")
+		cacheStale             = flagset.Duration("cache.stale", defaultCacheStale, "how long expired values are served whilst refreshing in the background (0 disabled)")
+		cacheMaxEntries        = flagset.Int("cache.establishments.max", defaultCacheMaxEntries, "maximum number of authorities to cache establishments for (0 unbounded)")
+		cacheMaxBytes          = flagset.Int("cache.establishments.bytes", defaultCacheMaxBytes, "maximum estimated bytes of cached establishments (0 unbounded)")
+		cacheDir               = flagset.String("cache.dir", "", "directory to persist results to, so they survive restarts (empty disabled)")
+		cacheDirTTL            = flagset.Duration("cache.dir.ttl", defaultCacheDirTTL, "how long persisted results live for (0 never expires)")
+		cacheWarm              = flagset.Bool("cache.warm", false, "prefetch the establishments for every authority on startup (requires an unbounded -cache)")
+		cacheWarmWorkers       = flagset.Int("cache.warm.workers", defaultCacheWarmWorkers, "number of concurrent requests used to warm the cache")
+
+		searchEnabled        = flagset.Bool("search", defaultSearch, "index requested establishments, so they can be searched (by name or location) across authorities")
+		searchMax            = flagset.Int("search.max", defaultSearchMax, "maximum number of establishments indexed, evicting the oldest authorities first (0 unbounded)")
+		aggregateConcurrency = flagset.Int("aggregate.concurrency", defaultAggregateConcurrency, "number of authorities requested concurrently when aggregating ratings")
+		rankingsSnapshot     = flagset.Duration("rankings.snapshot", defaultRankingsSnapshot, "how often the rankings of every authority are recalculated in the background (0 requests every authority for each request)")
 	)
 
 	flagset.Usage = usageFor(flagset, "query [flags]")
@@ -56,6 +111,12 @@ func runQuery(args []string) error {
 		logger = level.NewFilter(logger, logLevel)
 	}
 
+	// Warming requests every authority, so a bounded cache would just evict
+	// the authorities as soon as they're warmed.
+	if *cacheWarm && *cache && (*cacheMaxEntries > 0 || *cacheMaxBytes > 0) {
+		return errors.Errorf("-cache.warm requires an unbounded cache (-cache.establishments.max 0 -cache.establishments.bytes 0)")
+	}
+
 	// Parse the apiNetwork and apiAddress from the flag set
 	apiNetwork, apiAddress, err := parseAddr(*apiAddr, defaultAPIPort)
 	if err != nil {
@@ -73,13 +134,78 @@ func runQuery(args []string) error {
 	defer apiListener.Close()
 
 	// Service wraps the food agency API
-	serv := service.New(APIRatingsFoodURL, APIRatingsFoodVersion, log.With(logger, "component", "service"))
+	serv := service.New(APIRatingsFoodURL, APIRatingsFoodVersion, log.With(logger, "component", "service"),
+		service.WithRetries(*serviceRetries),
+		service.WithBackoff(*serviceBackoff, *serviceBackoffMax),
+		service.WithPaging(*servicePageSize, *servicePages),
+		service.WithRateLimit(*serviceRate, *serviceBurst),
+	)
+	if *breakerFailures > 0 {
+		serv = service.NewBreaker(serv, *breakerFailures, *breakerCooldown)
+	}
+	if *cacheDir != "" {
+		serv, err = service.NewDisk(serv, *cacheDir, *cacheDirTTL, log.With(logger, "component", "disk"))
+		if err != nil {
+			return err
+		}
+	}
+	// The snapshot crawls every authority, so it's taken from underneath the
+	// search and cache layers; otherwise each crawl would evict the entries
+	// that were requested by users and fill up the search index.
+	upstream := serv
+
+	apiOptions := []query.APIOption{
+		query.WithAggregateConcurrency(*aggregateConcurrency),
+	}
+	// The index is built from everything requested underneath the cache, so
+	// it grows as authorities are browsed (or warmed), up to -search.max. The
+	// spatial index resolves the establishments through it.
+	if *searchEnabled {
+		var (
+			index   = search.NewIndex(*searchMax)
+			spatial = search.NewSpatialIndex(index)
+		)
+		serv = search.NewService(serv, index, spatial)
+		apiOptions = append(apiOptions, query.WithIndex(index), query.WithSpatialIndex(spatial))
+	}
 	if *cache {
-		serv = service.NewCache(serv)
+		serv = service.NewCache(serv,
+			service.WithAuthoritiesTTL(*cacheAuthoritiesTTL),
+			service.WithEstablishmentsTTL(*cacheEstablishmentsTTL),
+			service.WithStaleWhileRevalidate(*cacheStale),
+			service.WithMaxEntries(*cacheMaxEntries),
+			service.WithMaxBytes(*cacheMaxBytes),
+		)
+	}
+
+	// Warm the cache in the background, so that we can still serve requests
+	// whilst it's warming.
+	if *cacheWarm {
+		if *cache || *cacheDir != "" {
+			go func() {
+				warmLogger := log.With(logger, "component", "warm")
+				if err := service.Warm(context.Background(), serv, *cacheWarmWorkers, warmLogger); err != nil {
+					level.Warn(warmLogger).Log("err", err)
+				}
+			}()
+		} else {
+			level.Warn(logger).Log("component", "warm", "err", "warming requires -cache or -cache.dir")
+		}
+	}
+
+	// Take a snapshot of the rankings in the background, so that the rankings
+	// (and the aggregates) don't have to request every authority for each
+	// request.
+	if *rankingsSnapshot > 0 {
+		snapshot := query.NewRankingsSnapshot(upstream, *aggregateConcurrency, log.With(logger, "component", "rankings"))
+		go snapshot.Run(context.Background(), *rankingsSnapshot)
+		apiOptions = append(apiOptions, query.WithRankingsSnapshot(snapshot))
+	} else if !*cache || *cacheMaxEntries > 0 || *cacheMaxBytes > 0 {
+		level.Warn(logger).Log("component", "rankings", "err", "with out a snapshot, the rankings and national aggregates request every authority for each request and the cache can not hold them all")
 	}
 
 	// API that is going to handle the incoming requests.
-	api := query.NewAPI(serv, log.With(logger, "component", "api"))
+	api := query.NewAPI(serv, log.With(logger, "component", "api"), apiOptions...)
 
 	mux := http.NewServeMux()
 	mux.Handle("/query/", http.StripPrefix("/query", api))
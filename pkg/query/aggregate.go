@@ -0,0 +1,186 @@
+package query
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+// AggregateLevel defines how the authorities are grouped together when
+// aggregating their ratings.
+type AggregateLevel string
+
+// These are the levels that the ratings can be aggregated at.
+const (
+	// AggregateRegion groups the authorities by their region.
+	AggregateRegion AggregateLevel = "region"
+	// AggregateCountry groups the authorities by the country of their region.
+	AggregateCountry AggregateLevel = "country"
+	// AggregateNational groups all the authorities together.
+	AggregateNational AggregateLevel = "national"
+)
+
+func (l AggregateLevel) valid() bool {
+	switch l {
+	case AggregateRegion, AggregateCountry, AggregateNational:
+		return true
+	}
+	return false
+}
+
+// These are the names of the groups that aren't named by the service.
+const (
+	nationalName = "United Kingdom"
+	unknownName  = "Unknown"
+)
+
+// groupName returns the name of the group that the authority belongs to for
+// the level.
+func (l AggregateLevel) groupName(authority service.Authority) string {
+	switch l {
+	case AggregateRegion:
+		if authority.Region == "" {
+			return unknownName
+		}
+		return authority.Region
+	case AggregateCountry:
+		return countryOf(authority.Region)
+	}
+	return nationalName
+}
+
+// countryOf returns the country of the region. The service names the regions
+// of Scotland, Wales and Northern Ireland after the country, every other region
+// is with in England.
+func countryOf(region string) string {
+	switch {
+	case region == "":
+		return unknownName
+	case strings.EqualFold(region, "Scotland"):
+		return "Scotland"
+	case strings.EqualFold(region, "Wales"):
+		return "Wales"
+	case strings.EqualFold(region, "Northern Ireland"):
+		return "Northern Ireland"
+	}
+	return "England"
+}
+
+// authorityGroup is a group of authorities that are aggregated together.
+type authorityGroup struct {
+	Name        string
+	Authorities []service.Authority
+}
+
+// groupAuthorities groups the authorities by the level, sorted by name. If a
+// name is given, then only the group with that name is returned.
+func groupAuthorities(authorities []service.Authority, level AggregateLevel, name string) []authorityGroup {
+	groups := map[string]*authorityGroup{}
+	for _, v := range authorities {
+		groupName := level.groupName(v)
+		if name != "" && !strings.EqualFold(groupName, name) {
+			continue
+		}
+		group, ok := groups[groupName]
+		if !ok {
+			group = &authorityGroup{Name: groupName}
+			groups[groupName] = group
+		}
+		group.Authorities = append(group.Authorities, v)
+	}
+
+	res := make([]authorityGroup, 0, len(groups))
+	for _, v := range groups {
+		res = append(res, *v)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// AggregateGroup is the ratings of a group of authorities.
+type AggregateGroup struct {
+	Name string
+	// Authorities is the number of authorities in the group and
+	// EstablishmentCount is the number of establishments the service reports
+	// for them, before any filters are applied.
+	Authorities        int
+	EstablishmentCount int
+	Scheme             Scheme
+	Total              int
+	Ratings            []Rating
+}
+
+// aggregate counts the ratings for every authority with in the groups and pools
+// them together for each group. Pooling the counts, rather than averaging the
+// percentages of each authority, means that every authority is weighted by the
+// number of its establishments.
+// The counts of the authorities in the snapshot (of the rankings) are used as
+// they are, only the authorities missing from it are requested from the
+// service. The snapshot is unfiltered, so it's expected to be empty if there
+// are any filters.
+func aggregate(ctx context.Context, s service.Service, groups []authorityGroup, p AggregateQueryParams, concurrency int, snapshot []authorityRatings) ([]AggregateGroup, error) {
+	byLocalID := make(map[int]*ratingsCounter, len(snapshot))
+	for _, v := range snapshot {
+		byLocalID[v.Authority.LocalID] = v.counter()
+	}
+
+	// Request the largest authorities first, so that the slowest requests
+	// aren't left until the end.
+	var authorities []service.Authority
+	for _, group := range groups {
+		for _, v := range group.Authorities {
+			if _, ok := byLocalID[v.LocalID]; !ok {
+				authorities = append(authorities, v)
+			}
+		}
+	}
+	sort.SliceStable(authorities, func(i, j int) bool {
+		return authorities[i].EstablishmentCount > authorities[j].EstablishmentCount
+	})
+
+	localIDs := make([]string, len(authorities))
+	for k, v := range authorities {
+		localIDs[k] = strconv.Itoa(v.LocalID)
+	}
+
+	counters, err := countAuthorities(ctx, s, localIDs, p.EstablishmentsFilters, concurrency)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range authorities {
+		byLocalID[v.LocalID] = counters[k]
+	}
+
+	res := make([]AggregateGroup, len(groups))
+	for k, group := range groups {
+		var (
+			counter = newRatingsCounter()
+			count   int
+		)
+		for _, v := range group.Authorities {
+			counter.Merge(byLocalID[v.LocalID])
+			count += v.EstablishmentCount
+		}
+
+		var (
+			scheme  = counter.Scheme()
+			ratings = counter.Ratings()
+		)
+		sortRatings(ratings, scheme, p.Sort)
+
+		res[k] = AggregateGroup{
+			Name:               group.Name,
+			Authorities:        len(group.Authorities),
+			EstablishmentCount: count,
+			Scheme:             scheme,
+			Total:              counter.total,
+			Ratings:            ratings,
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,183 @@
+package query
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+func TestCountryOf(t *testing.T) {
+	t.Parallel()
+
+	for region, country := range map[string]string{
+		"Yorkshire and Humberside": "England",
+		"London":                   "England",
+		"Scotland":                 "Scotland",
+		"wales":                    "Wales",
+		"Northern Ireland":         "Northern Ireland",
+		"":                         unknownName,
+	} {
+		if expected, actual := country, countryOf(region); expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", region, expected, actual)
+		}
+	}
+}
+
+func TestGroupAuthorities(t *testing.T) {
+	t.Parallel()
+
+	authorities := []service.Authority{
+		service.Authority{LocalID: 1, Region: "Wales"},
+		service.Authority{LocalID: 2, Region: "Yorkshire and Humberside"},
+		service.Authority{LocalID: 3, Region: "London"},
+		service.Authority{LocalID: 4, Region: "Scotland"},
+	}
+	names := func(groups []authorityGroup) map[string][]int {
+		res := map[string][]int{}
+		for _, v := range groups {
+			for _, a := range v.Authorities {
+				res[v.Name] = append(res[v.Name], a.LocalID)
+			}
+		}
+		return res
+	}
+
+	for _, test := range []struct {
+		level AggregateLevel
+		name  string
+		want  map[string][]int
+	}{
+		{AggregateNational, "", map[string][]int{nationalName: {1, 2, 3, 4}}},
+		{AggregateCountry, "", map[string][]int{"England": {2, 3}, "Scotland": {4}, "Wales": {1}}},
+		{AggregateCountry, "england", map[string][]int{"England": {2, 3}}},
+		{AggregateRegion, "London", map[string][]int{"London": {3}}},
+		{AggregateRegion, "Narnia", map[string][]int{}},
+	} {
+		if expected, actual := test.want, names(groupAuthorities(authorities, test.level, test.name)); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s %q: expected: %v, actual: %v", test.level, test.name, expected, actual)
+		}
+	}
+}
+
+// concurrencyService records the number and the maximum number of concurrent
+// requests for establishments.
+type concurrencyService struct {
+	service.Service
+
+	mutex    sync.Mutex
+	requests int
+	inflight int
+	max      int
+}
+
+func (s *concurrencyService) EstablishmentsForAuthority(ctx context.Context, localID string) ([]service.Establishment, error) {
+	s.mutex.Lock()
+	s.requests++
+	s.inflight++
+	if s.inflight > s.max {
+		s.max = s.inflight
+	}
+	s.mutex.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	s.mutex.Lock()
+	s.inflight--
+	s.mutex.Unlock()
+
+	id, _ := strconv.Atoi(localID)
+	return []service.Establishment{
+		service.Establishment{ID: id, Rating: "5"},
+	}, nil
+}
+
+func TestAggregate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		s           = &concurrencyService{}
+		authorities = make([]service.Authority, 10)
+	)
+	for k := range authorities {
+		authorities[k] = service.Authority{
+			LocalID:            k,
+			EstablishmentCount: 1,
+			Region:             "Wales",
+		}
+	}
+
+	groups := groupAuthorities(authorities, AggregateNational, "")
+	res, err := aggregate(context.Background(), s, groups, AggregateQueryParams{Sort: SortCanonical}, 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := true, s.max <= 3; expected != actual {
+		t.Errorf("expected: %v, actual: %v (max: %d)", expected, actual, s.max)
+	}
+	if expected, actual := 1, len(res); expected != actual {
+		t.Fatalf("expected: %v, actual: %v", expected, actual)
+	}
+	want := AggregateGroup{
+		Name:               nationalName,
+		Authorities:        10,
+		EstablishmentCount: 10,
+		Scheme:             SchemeFHRS,
+		Total:              10,
+		Ratings: []Rating{
+			Rating{Name: "5-Star", Rating: 100, Count: 10, Total: 10, Rounded: 100},
+		},
+	}
+	if expected, actual := want, res[0]; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestAggregateSnapshot(t *testing.T) {
+	t.Parallel()
+
+	var (
+		s           = &concurrencyService{}
+		authorities = make([]service.Authority, 10)
+		snapshot    []authorityRatings
+	)
+	for k := range authorities {
+		authorities[k] = service.Authority{
+			LocalID:            k,
+			EstablishmentCount: 1,
+			Region:             "Wales",
+		}
+		// Leave the last authority out of the snapshot, as if it failed.
+		if k < len(authorities)-1 {
+			counter := newRatingsCounter()
+			counter.Add(service.Establishment{Rating: "0"})
+			snapshot = append(snapshot, newAuthorityRatings(authorities[k], counter))
+		}
+	}
+
+	groups := groupAuthorities(authorities, AggregateNational, "")
+	res, err := aggregate(context.Background(), s, groups, AggregateQueryParams{Sort: SortCanonical}, 3, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the authority missing from the snapshot should be requested.
+	if expected, actual := 1, s.requests; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := 1, len(res); expected != actual {
+		t.Fatalf("expected: %v, actual: %v", expected, actual)
+	}
+	want := []Rating{
+		Rating{Name: "0-Star", Rating: 90, Count: 9, Total: 10, Rounded: 90},
+		Rating{Name: "5-Star", Rating: 10, Count: 1, Total: 10, Rounded: 10},
+	}
+	if expected, actual := want, res[0].Ratings; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
@@ -1,10 +1,15 @@
 package query
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/SimonRichardson/foodhygiene/pkg/search"
 	"github.com/SimonRichardson/foodhygiene/pkg/service"
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
@@ -14,20 +19,85 @@ import (
 const (
 	APIPathAuthorities    = "/authorities"
 	APIPathEstablishments = "/establishments"
+	APIPathList           = "/establishments/list"
+	APIPathEstablishment  = "/establishment"
+	APIPathSearch         = "/search"
+	APIPathNearby         = "/nearby"
+	APIPathCompare        = "/compare"
+	APIPathAggregate      = "/aggregate"
+	APIPathRankings       = "/rankings"
+	APIPathRegions        = "/regions"
+	APIPathCountries      = "/countries"
+	APIPathBusinessTypes  = "/businesstypes"
+	APIPathSchemeTypes    = "/schemetypes"
+	APIPathRatings        = "/ratings"
 )
 
 // API serves the query API
 type API struct {
-	service service.Service
-	logger  log.Logger
+	service              service.Service
+	index                *search.Index
+	spatial              *search.SpatialIndex
+	aggregateConcurrency int
+	rankings             *RankingsSnapshot
+	logger               log.Logger
+}
+
+// defaultAggregateConcurrency is the number of authorities requested
+// concurrently when aggregating, unless it's set with an APIOption.
+const defaultAggregateConcurrency = 4
+
+// rankingsRetryAfter is how long the client is told to wait, when the rankings
+// are requested before the first snapshot has been taken.
+const rankingsRetryAfter = 30 * time.Second
+
+// APIOption defines a option for configuring the API.
+type APIOption func(*API)
+
+// WithIndex sets the search index used to search for establishments across
+// every authority. With out an index, searching isn't available.
+func WithIndex(index *search.Index) APIOption {
+	return func(a *API) {
+		a.index = index
+	}
+}
+
+// WithSpatialIndex sets the spatial index used to find the establishments near
+// to a location. With out an index, nearby queries aren't available.
+func WithSpatialIndex(index *search.SpatialIndex) APIOption {
+	return func(a *API) {
+		a.spatial = index
+	}
+}
+
+// WithAggregateConcurrency sets the number of authorities that are requested
+// concurrently when aggregating the ratings of a group of authorities.
+func WithAggregateConcurrency(n int) APIOption {
+	return func(a *API) {
+		a.aggregateConcurrency = n
+	}
+}
+
+// WithRankingsSnapshot sets the snapshot that the rankings are served from.
+// With out a snapshot (or until it's been taken), the rankings are calculated
+// from every authority for each request.
+func WithRankingsSnapshot(snapshot *RankingsSnapshot) APIOption {
+	return func(a *API) {
+		a.rankings = snapshot
+	}
 }
 
 // NewAPI creates a API with correct dependencies.
-func NewAPI(service service.Service, logger log.Logger) *API {
-	return &API{
-		service: service,
-		logger:  logger,
+func NewAPI(service service.Service, logger log.Logger, options ...APIOption) *API {
+	a := &API{
+		service:              service,
+		logger:               logger,
+		aggregateConcurrency: defaultAggregateConcurrency,
 	}
+	for _, option := range options {
+		option(a)
+	}
+	return a
 }
 
 func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -40,6 +110,30 @@ func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		a.handleAuthorities(w, r)
 	case method == "GET" && path == APIPathEstablishments:
 		a.handleEstablishments(w, r)
+	case method == "GET" && path == APIPathList:
+		a.handleList(w, r)
+	case method == "GET" && path == APIPathEstablishment:
+		a.handleEstablishment(w, r)
+	case method == "GET" && path == APIPathSearch:
+		a.handleSearch(w, r)
+	case method == "GET" && path == APIPathNearby:
+		a.handleNearby(w, r)
+	case method == "GET" && path == APIPathCompare:
+		a.handleCompare(w, r)
+	case method == "GET" && path == APIPathAggregate:
+		a.handleAggregate(w, r)
+	case method == "GET" && path == APIPathRankings:
+		a.handleRankings(w, r)
+	case method == "GET" && path == APIPathRegions:
+		a.handleReferences(w, r, "regions", a.regions)
+	case method == "GET" && path == APIPathCountries:
+		a.handleReferences(w, r, "countries", a.countries)
+	case method == "GET" && path == APIPathBusinessTypes:
+		a.handleReferences(w, r, "business types", a.businessTypes)
+	case method == "GET" && path == APIPathSchemeTypes:
+		a.handleReferences(w, r, "scheme types", a.schemeTypes)
+	case method == "GET" && path == APIPathRatings:
+		a.handleReferences(w, r, "ratings", a.ratings)
 	default:
 		http.NotFound(w, r)
 	}
@@ -57,19 +151,25 @@ func (a *API) handleAuthorities(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate user input
+	var p AuthoritiesQueryParams
+	if err := p.DecodeFrom(r.URL, queryOptional); err != nil {
+		queryError(w, err)
+		return
+	}
+
 	// Get the authorities from the service
-	authorities, err := a.service.Authorities()
+	authorities, err := a.service.Authorities(r.Context())
 	if err != nil {
 		// Wrap the error request, so that we're more specific
-		e := errors.Wrap(err, "error requesting authorities")
-		JSONError(w, e.Error(), http.StatusInternalServerError)
+		serviceError(w, errors.Wrap(err, "error requesting authorities"))
 		return
 	}
 
 	// AuthoritiesResult prints out the json
 	qr := AuthoritiesResult{
 		Duration: time.Since(begin).String(),
-		Records:  authorities,
+		Records:  filterAuthorities(authorities, p),
 	}
 	qr.EncodeTo(w)
 }
@@ -89,29 +189,406 @@ func (a *API) handleEstablishments(w http.ResponseWriter, r *http.Request) {
 	// Validate user input
 	var p EstablishmentsQueryParams
 	if err := p.DecodeFrom(r.URL, queryRequired); err != nil {
-		JSONError(w, err.Error(), http.StatusBadRequest)
+		queryError(w, err)
 		return
 	}
 
-	establishments, err := a.service.EstablishmentsForAuthority(p.LocalID)
-	if err != nil {
-		e := errors.Wrapf(err, "error requesting establishments for authority %q", p.LocalID)
-		JSONError(w, e.Error(), http.StatusInternalServerError)
+	// Record the freshness of the establishments, so that we can tell the
+	// client if it's been served stale data.
+	ctx, freshness := service.WithFreshness(r.Context())
+
+	// Calculate the ratings of the establishments for the authority that match
+	// the filters, as they're streamed from the service.
+	counter := newRatingsCounter()
+	if err := service.StreamEstablishmentsForAuthority(ctx, a.service, p.LocalID, func(e service.Establishment) error {
+		if p.match(e) {
+			counter.Add(e)
+		}
+		return nil
+	}); err != nil {
+		serviceError(w, errors.Wrapf(err, "error requesting establishments for authority %q", p.LocalID))
 		return
 	}
-
-	// Calculate the ratings of the whole establishments for the authority
-	ratings := calculateRatings(establishments)
+	var (
+		scheme  = counter.Scheme()
+		ratings = counter.Ratings()
+	)
+	sortRatings(ratings, scheme, p.Sort)
 
 	// EstablishmentsResult prints out the json
 	qr := EstablishmentsResult{
+		Params:    p,
+		Duration:  time.Since(begin).String(),
+		Freshness: *freshness,
+		Scheme:    scheme,
+		Records:   ratings,
+		Stats:     counter.Stats(),
+	}
+	qr.EncodeTo(w)
+}
+
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	// useful metrics
+	begin := time.Now()
+
+	defer r.Body.Close()
+
+	// Let's guard against invalid content-types
+	if !validContentType(r) {
+		JSONError(w, "invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	// Validate user input
+	var p EstablishmentsListQueryParams
+	if err := p.DecodeFrom(r.URL, queryRequired); err != nil {
+		queryError(w, err)
+		return
+	}
+
+	// Record the freshness of the establishments, so that we can tell the
+	// client if it's been served stale data.
+	ctx, freshness := service.WithFreshness(r.Context())
+
+	establishments, err := a.service.EstablishmentsForAuthority(ctx, p.LocalID)
+	if err != nil {
+		serviceError(w, errors.Wrapf(err, "error requesting establishments for authority %q", p.LocalID))
+		return
+	}
+	records, next := listEstablishments(establishments, p)
+
+	// ListResult prints out the json
+	qr := ListResult{
+		Params:    p,
+		Duration:  time.Since(begin).String(),
+		Freshness: *freshness,
+		Records:   records,
+		Next:      next,
+	}
+	qr.EncodeTo(w)
+}
+
+func (a *API) handleEstablishment(w http.ResponseWriter, r *http.Request) {
+	// useful metrics
+	begin := time.Now()
+
+	defer r.Body.Close()
+
+	// Let's guard against invalid content-types
+	if !validContentType(r) {
+		JSONError(w, "invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	// Validate user input
+	var p EstablishmentQueryParams
+	if err := p.DecodeFrom(r.URL, queryRequired); err != nil {
+		queryError(w, err)
+		return
+	}
+
+	// Record the freshness of the establishment, so that we can tell the
+	// client if it's been served stale data.
+	ctx, freshness := service.WithFreshness(r.Context())
+
+	establishment, err := a.service.Establishment(ctx, p.ID)
+	if err != nil {
+		serviceError(w, errors.Wrapf(err, "error requesting establishment %d", p.ID))
+		return
+	}
+
+	// EstablishmentResult prints out the json
+	qr := EstablishmentResult{
+		Params:    p,
+		Duration:  time.Since(begin).String(),
+		Freshness: *freshness,
+		Record:    establishment,
+	}
+	qr.EncodeTo(w)
+}
+
+func (a *API) handleSearch(w http.ResponseWriter, r *http.Request) {
+	// useful metrics
+	begin := time.Now()
+
+	defer r.Body.Close()
+
+	// Let's guard against invalid content-types
+	if !validContentType(r) {
+		JSONError(w, "invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	if a.index == nil {
+		JSONError(w, "search is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	// Validate user input
+	var p SearchQueryParams
+	if err := p.DecodeFrom(r.URL, queryRequired); err != nil {
+		queryError(w, err)
+		return
+	}
+
+	// SearchResult prints out the json
+	qr := SearchResult{
+		Params:      p,
+		Duration:    time.Since(begin).String(),
+		Authorities: a.index.Authorities(),
+		Records:     a.index.Search(p.Query, p.Limit),
+	}
+	qr.EncodeTo(w)
+}
+
+func (a *API) handleNearby(w http.ResponseWriter, r *http.Request) {
+	// useful metrics
+	begin := time.Now()
+
+	defer r.Body.Close()
+
+	// Let's guard against invalid content-types
+	if !validContentType(r) {
+		JSONError(w, "invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	if a.spatial == nil {
+		JSONError(w, "nearby is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	// Validate user input
+	var p NearbyQueryParams
+	if err := p.DecodeFrom(r.URL, queryRequired); err != nil {
+		queryError(w, err)
+		return
+	}
+
+	// The ratings are calculated from every establishment with in the radius,
+	// even if they're not all returned.
+	var (
+		results = a.spatial.Nearby(p.Latitude, p.Longitude, p.Radius)
+		counter = newRatingsCounter()
+	)
+	for _, v := range results {
+		counter.Add(v.Establishment)
+	}
+	if len(results) > p.Limit {
+		results = results[:p.Limit]
+	}
+
+	// NearbyResult prints out the json
+	qr := NearbyResult{
+		Params:      p,
+		Duration:    time.Since(begin).String(),
+		Authorities: a.spatial.Authorities(),
+		Scheme:      counter.Scheme(),
+		Records:     results,
+		Ratings:     counter.Ratings(),
+	}
+	qr.EncodeTo(w)
+}
+
+func (a *API) handleCompare(w http.ResponseWriter, r *http.Request) {
+	// useful metrics
+	begin := time.Now()
+
+	defer r.Body.Close()
+
+	// Let's guard against invalid content-types
+	if !validContentType(r) {
+		JSONError(w, "invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	// Validate user input
+	var p CompareQueryParams
+	if err := p.DecodeFrom(r.URL, queryRequired); err != nil {
+		queryError(w, err)
+		return
+	}
+
+	counters, err := countAuthorities(r.Context(), a.service, p.LocalIDs, p.EstablishmentsFilters, len(p.LocalIDs))
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+
+	// CompareResult prints out the json
+	qr := CompareResult{
+		Params:   p,
+		Duration: time.Since(begin).String(),
+		Records:  compare(p.LocalIDs, counters, p.Sort),
+	}
+	qr.EncodeTo(w)
+}
+
+func (a *API) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	// useful metrics
+	begin := time.Now()
+
+	defer r.Body.Close()
+
+	// Let's guard against invalid content-types
+	if !validContentType(r) {
+		JSONError(w, "invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	// Validate user input
+	var p AggregateQueryParams
+	if err := p.DecodeFrom(r.URL, queryRequired); err != nil {
+		queryError(w, err)
+		return
+	}
+
+	authorities, err := a.service.Authorities(r.Context())
+	if err != nil {
+		serviceError(w, errors.Wrap(err, "error requesting authorities"))
+		return
+	}
+
+	groups := groupAuthorities(authorities, p.Level, p.Name)
+	if p.Name != "" && len(groups) == 0 {
+		JSONParamError(w, "name", fmt.Sprintf("unknown %s %q", p.Level, p.Name), http.StatusNotFound)
+		return
+	}
+
+	// Use the counts from the rankings snapshot if there is one, so that a
+	// national aggregate doesn't have to request every authority. The snapshot
+	// is unfiltered, so it can't be used if there are any filters.
+	var (
+		snapshot []authorityRatings
+		taken    time.Time
+	)
+	if a.rankings != nil && p.EstablishmentsFilters == (EstablishmentsFilters{}) {
+		snapshot, taken, _ = a.rankings.snapshot()
+	}
+
+	records, err := aggregate(r.Context(), a.service, groups, p, a.aggregateConcurrency, snapshot)
+	if err != nil {
+		serviceError(w, err)
+		return
+	}
+
+	// AggregateResult prints out the json
+	qr := AggregateResult{
+		Params:   p,
+		Duration: time.Since(begin).String(),
+		Snapshot: taken,
+		Records:  records,
+	}
+	qr.EncodeTo(w)
+}
+
+func (a *API) handleRankings(w http.ResponseWriter, r *http.Request) {
+	// useful metrics
+	begin := time.Now()
+
+	defer r.Body.Close()
+
+	// Let's guard against invalid content-types
+	if !validContentType(r) {
+		JSONError(w, "invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	// Validate user input
+	var p RankingsQueryParams
+	if err := p.DecodeFrom(r.URL, queryOptional); err != nil {
+		queryError(w, err)
+		return
+	}
+
+	// Serve from the snapshot if there is one, otherwise every authority has
+	// to be requested. Whilst the first snapshot is being taken, we tell the
+	// client to try again later, rather than requesting every authority for
+	// each request along side the snapshot.
+	var (
+		ratings []authorityRatings
+		taken   time.Time
+	)
+	if a.rankings != nil {
+		var ok bool
+		if ratings, taken, ok = a.rankings.snapshot(); !ok {
+			w.Header().Set(httpHeaderRetryAfter, strconv.Itoa(int(rankingsRetryAfter.Seconds())))
+			JSONError(w, "rankings snapshot is not ready", http.StatusServiceUnavailable)
+			return
+		}
+	} else {
+		var err error
+		if ratings, err = liveAuthorityRatings(r.Context(), a.service, a.aggregateConcurrency); err != nil {
+			serviceError(w, err)
+			return
+		}
+	}
+
+	rankings := rankAuthorities(ratings, p.Metric, p.MinEstablishments)
+	if p.Limit > 0 && len(rankings) > p.Limit {
+		rankings = rankings[:p.Limit]
+	}
+
+	// RankingsResult prints out the json
+	qr := RankingsResult{
 		Params:   p,
 		Duration: time.Since(begin).String(),
-		Records:  ratings,
+		Snapshot: taken,
+		Records:  rankings,
 	}
 	qr.EncodeTo(w)
 }
 
+func (a *API) handleReferences(w http.ResponseWriter, r *http.Request, name string, fn func(context.Context) ([]OutputReference, error)) {
+	// useful metrics
+	begin := time.Now()
+
+	defer r.Body.Close()
+
+	// Let's guard against invalid content-types
+	if !validContentType(r) {
+		JSONError(w, "invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	// Record the freshness of the reference data, so that we can tell the
+	// client if it's been served stale data.
+	ctx, freshness := service.WithFreshness(r.Context())
+
+	references, err := fn(ctx)
+	if err != nil {
+		serviceError(w, errors.Wrapf(err, "error requesting %s", name))
+		return
+	}
+
+	// ReferencesResult prints out the json
+	qr := ReferencesResult{
+		Duration:  time.Since(begin).String(),
+		Freshness: *freshness,
+		Records:   references,
+	}
+	qr.EncodeTo(w)
+}
+
+// serviceError replies to the request with the error from the service. If the
+// service is failing fast because the circuit breaker is open, then we tell the
+// client when to try again. If the service doesn't know about the entity then
+// it's not found, otherwise it's an internal error.
+func serviceError(w http.ResponseWriter, err error) {
+	cause := errors.Cause(err)
+	if e, ok := cause.(*service.CircuitOpenError); ok {
+		retryAfter := int(math.Ceil(e.RetryAfter.Seconds()))
+		w.Header().Set(httpHeaderRetryAfter, strconv.Itoa(retryAfter))
+		JSONError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if cause == service.ErrNotFound {
+		JSONError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	JSONError(w, err.Error(), http.StatusInternalServerError)
+}
+
 // Validate the header content-type.
 func validContentType(r *http.Request) bool {
 	t := r.Header.Get("Content-Type")
@@ -129,6 +606,10 @@ func (iw *interceptingWriter) WriteHeader(code int) {
 }
 
 const (
-	httpHeaderDuration = "X-Proxy-Duration"
-	httpHeaderLocalID  = "X-Local-ID"
+	httpHeaderDuration    = "X-Proxy-Duration"
+	httpHeaderLocalID     = "X-Local-ID"
+	httpHeaderCacheStatus = "X-Cache-Status"
+	httpHeaderAge         = "Age"
+	httpHeaderRetryAfter  = "Retry-After"
+	httpHeaderScheme      = "X-Rating-Scheme"
 )
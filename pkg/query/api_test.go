@@ -1,16 +1,20 @@
 package query
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"encoding/json"
 
 	"reflect"
 
+	"github.com/SimonRichardson/foodhygiene/pkg/search"
 	"github.com/SimonRichardson/foodhygiene/pkg/service"
 	"github.com/SimonRichardson/foodhygiene/pkg/service/mock_service"
 	"github.com/go-kit/kit/log"
@@ -34,7 +38,7 @@ func TestAPIAuthorities(t *testing.T) {
 		defer server.Close()
 
 		mock.EXPECT().
-			Authorities().
+			Authorities(gomock.Any()).
 			Return([]service.Authority{}, nil)
 
 		res, err := request(u)
@@ -71,7 +75,7 @@ func TestAPIAuthorities(t *testing.T) {
 		name, localID := "Yorkshire", 123
 
 		mock.EXPECT().
-			Authorities().
+			Authorities(gomock.Any()).
 			Return([]service.Authority{
 				service.Authority{
 					Name:    name,
@@ -95,7 +99,7 @@ func TestAPIAuthorities(t *testing.T) {
 		if expected, actual := 1, len(auth); expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
-		if expected, actual := (OutputAuthority{name, localID}), auth[0]; !reflect.DeepEqual(expected, actual) {
+		if expected, actual := (OutputAuthority{Name: name, LocalID: localID}), auth[0]; !reflect.DeepEqual(expected, actual) {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
@@ -114,7 +118,7 @@ func TestAPIAuthorities(t *testing.T) {
 		defer server.Close()
 
 		mock.EXPECT().
-			Authorities().
+			Authorities(gomock.Any()).
 			Return(nil, errors.New("something went wrong"))
 
 		res, err := request(u)
@@ -126,6 +130,59 @@ func TestAPIAuthorities(t *testing.T) {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
+
+	t.Run("region", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/authorities?region=yorkshire%%20and%%20humberside", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{
+				service.Authority{
+					Name:    "York",
+					LocalID: 123,
+					Region:  "Yorkshire and Humberside",
+				},
+				service.Authority{
+					Name:    "Bath",
+					LocalID: 456,
+					Region:  "South West",
+				},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var auth []OutputAuthority
+		if err := json.NewDecoder(res.Body).Decode(&auth); err != nil {
+			t.Fatal(err)
+		}
+		want := []OutputAuthority{
+			OutputAuthority{
+				Name:    "York",
+				LocalID: 123,
+				Region:  "Yorkshire and Humberside",
+			},
+		}
+		if expected, actual := want, auth; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
 }
 
 func TestAPIEstablishments(t *testing.T) {
@@ -145,7 +202,7 @@ func TestAPIEstablishments(t *testing.T) {
 		defer server.Close()
 
 		mock.EXPECT().
-			EstablishmentsForAuthority("0").
+			EstablishmentsForAuthority(gomock.Any(), "0").
 			Return([]service.Establishment{}, nil)
 
 		res, err := request(u)
@@ -182,7 +239,7 @@ func TestAPIEstablishments(t *testing.T) {
 		name, rating := "Bobs burgers", "4"
 
 		mock.EXPECT().
-			EstablishmentsForAuthority("0").
+			EstablishmentsForAuthority(gomock.Any(), "0").
 			Return([]service.Establishment{
 				service.Establishment{
 					Name:   name,
@@ -206,7 +263,14 @@ func TestAPIEstablishments(t *testing.T) {
 		if expected, actual := 1, len(rate); expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
-		if expected, actual := (OutputRating{fmt.Sprintf("%s-Star", rating), "100.00%"}), rate[0]; !reflect.DeepEqual(expected, actual) {
+		if expected, actual := (OutputRating{
+			Name:       fmt.Sprintf("%s-Star", rating),
+			Rating:     "100.00%",
+			Count:      1,
+			Total:      1,
+			Percentage: 100,
+			Rounded:    100,
+		}), rate[0]; !reflect.DeepEqual(expected, actual) {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
@@ -225,7 +289,7 @@ func TestAPIEstablishments(t *testing.T) {
 		defer server.Close()
 
 		mock.EXPECT().
-			EstablishmentsForAuthority("0").
+			EstablishmentsForAuthority(gomock.Any(), "0").
 			Return(nil, errors.New("something went wrong"))
 
 		res, err := request(u)
@@ -238,6 +302,109 @@ func TestAPIEstablishments(t *testing.T) {
 		}
 	})
 
+	t.Run("cache status", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(service.NewCache(mock), log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments?local_id=0", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{
+				service.Establishment{
+					Name:   "Bobs burgers",
+					Rating: "4",
+				},
+			}, nil)
+
+		for _, status := range []string{"miss", "fresh"} {
+			res, err := request(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected, actual := status, res.Header.Get("X-Cache-Status"); expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := "0", res.Header.Get("Age"); expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("rating scheme", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments?local_id=0", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{
+				service.Establishment{
+					Name:   "Bobs burgers",
+					Rating: "Pass",
+				},
+				service.Establishment{
+					Name:   "Freds Pizzas",
+					Rating: "Improvement Required",
+				},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := "FHIS", res.Header.Get("X-Rating-Scheme"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("circuit open", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments?local_id=0", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return(nil, &service.CircuitOpenError{RetryAfter: 1500 * time.Millisecond})
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusServiceUnavailable, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "2", res.Header.Get("Retry-After"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
 	t.Run("error no local id", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
@@ -260,6 +427,1264 @@ func TestAPIEstablishments(t *testing.T) {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
+
+	t.Run("filtered", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments?local_id=0&district=YO1&exclude_awaiting=true", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{
+				service.Establishment{
+					Name:     "Bobs burgers",
+					Rating:   "4",
+					PostCode: "YO1 7HH",
+				},
+				service.Establishment{
+					Name:     "Freds Pizzas",
+					Rating:   "AwaitingInspection",
+					PostCode: "YO1 8AA",
+				},
+				service.Establishment{
+					Name:     "Alices Cafe",
+					Rating:   "5",
+					PostCode: "YO10 3DD",
+				},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var rate []OutputRating
+		if err := json.NewDecoder(res.Body).Decode(&rate); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, len(rate); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "4-Star", rate[0].Name; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, rate[0].Total; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments?local_id=0&stats=true", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{
+				service.Establishment{Name: "Bobs burgers", Rating: "5"},
+				service.Establishment{Name: "Freds Pizzas", Rating: "3"},
+				service.Establishment{Name: "Alices Cafe", Rating: "AwaitingInspection"},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var output OutputEstablishments
+		if err := json.NewDecoder(res.Body).Decode(&output); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := SchemeFHRS, output.Scheme; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 3, len(output.Ratings); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, output.Stats.Rated; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if output.Stats.Mean == nil || output.Stats.FiveStar == nil {
+			t.Fatalf("expected numeric stats, actual: %v", output.Stats)
+		}
+		if expected, actual := 4.0, *output.Stats.Mean; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 50.0, output.Stats.FiveStar.Share; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error invalid filter", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments?local_id=0&rating_from=yesterday", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusBadRequest, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var e rawError
+		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "rating_from", e.Param; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPIList(t *testing.T) {
+	t.Parallel()
+
+	t.Run("paged", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments/list?local_id=0&rating=4&limit=1", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{
+				service.Establishment{
+					ID:       2,
+					Name:     "Freds Pizzas",
+					Rating:   "4",
+					Address1: "1 High Street",
+					PostCode: "AB1 2CD",
+				},
+				service.Establishment{
+					ID:     1,
+					Name:   "Bobs burgers",
+					Rating: "4",
+				},
+				service.Establishment{
+					ID:     3,
+					Name:   "Alices Cafe",
+					Rating: "5",
+				},
+			}, nil).
+			Times(2)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var list OutputList
+		if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, len(list.Establishments); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "Bobs burgers", list.Establishments[0].Name; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if list.Next == "" {
+			t.Fatal("expected next cursor")
+		}
+
+		res, err = request(fmt.Sprintf("%s&cursor=%s", u, list.Next))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		list = OutputList{}
+		if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		want := OutputList{
+			Establishments: []OutputEstablishment{
+				OutputEstablishment{
+					ID:       2,
+					Name:     "Freds Pizzas",
+					Address:  []string{"1 High Street"},
+					PostCode: "AB1 2CD",
+					Rating:   "4-Star",
+					Scheme:   SchemeFHRS,
+				},
+			},
+		}
+		if expected, actual := want, list; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments/list?local_id=0", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return(nil, errors.New("something went wrong"))
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusInternalServerError, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("business type", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments/list?local_id=0&business_type=7843", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{
+				service.Establishment{
+					ID:             1,
+					Name:           "Bobs burgers",
+					Rating:         "4",
+					BusinessTypeID: 1,
+				},
+				service.Establishment{
+					ID:             2,
+					Name:           "Freds Pizzas",
+					Rating:         "4",
+					BusinessTypeID: 7843,
+				},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var list OutputList
+		if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, len(list.Establishments); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, list.Establishments[0].ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error no local id", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishments/list", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusBadRequest, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPIEstablishment(t *testing.T) {
+	t.Parallel()
+
+	t.Run("one", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishment?id=123", server.URL)
+
+			hygiene = 5
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			Establishment(gomock.Any(), 123).
+			Return(service.Establishment{
+				ID:         123,
+				Name:       "Bobs burgers",
+				Address1:   "1 High Street",
+				Address3:   "York",
+				PostCode:   "YO1 1AA",
+				Rating:     "5",
+				RatingDate: service.Date{Time: time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)},
+				Scheme:     "FHRS",
+				Scores: service.Scores{
+					Hygiene: &hygiene,
+				},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var got OutputEstablishmentDetail
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		want := OutputEstablishmentDetail{
+			OutputEstablishment: OutputEstablishment{
+				ID:         123,
+				Name:       "Bobs burgers",
+				Address:    []string{"1 High Street", "York"},
+				PostCode:   "YO1 1AA",
+				Rating:     "5-Star",
+				RatingDate: "2017-06-01",
+				Scheme:     SchemeFHRS,
+			},
+			Scores: OutputScores{
+				Hygiene: &hygiene,
+			},
+		}
+		if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/establishment?id=123", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			Establishment(gomock.Any(), 123).
+			Return(service.Establishment{}, service.ErrNotFound)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusNotFound, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error invalid id", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+		)
+		defer server.Close()
+
+		for _, query := range []string{"", "?id=", "?id=abc", "?id=-1"} {
+			res, err := request(fmt.Sprintf("%s/establishment%s", server.URL, query))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected, actual := http.StatusBadRequest, res.StatusCode; expected != actual {
+				t.Errorf("%s: expected: %v, actual: %v", query, expected, actual)
+			}
+		}
+	})
+}
+
+func TestAPISearch(t *testing.T) {
+	t.Parallel()
+
+	t.Run("found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		index := search.NewIndex(0)
+		index.Add("1", []service.Establishment{
+			service.Establishment{ID: 1, Name: "Bobs burgers", PostCode: "YO1 7HH", Rating: "5"},
+			service.Establishment{ID: 2, Name: "Freds Pizzas", PostCode: "YO1 8AA", Rating: "3"},
+		})
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger(), WithIndex(index))
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/search?q=bob+yo1", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got OutputSearch
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := OutputSearch{
+			Establishments: []OutputSearchEstablishment{
+				OutputSearchEstablishment{
+					ID:       1,
+					Name:     "Bobs burgers",
+					PostCode: "YO1 7HH",
+					Rating:   "5-Star",
+					Scheme:   SchemeFHRS,
+					LocalID:  "1",
+				},
+			},
+			Authorities: 1,
+		}
+		if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The index doesn't keep the address or the business type, so they
+		// shouldn't be output as if they were empty.
+		var raw struct {
+			Establishments []map[string]interface{} `json:"establishments"`
+		}
+		if err := json.Unmarshal(body, &raw); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"address", "business_type"} {
+			if _, ok := raw.Establishments[0][key]; ok {
+				t.Errorf("unexpected %q", key)
+			}
+		}
+	})
+
+	t.Run("error no query", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger(), WithIndex(search.NewIndex(0)))
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/search", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusBadRequest, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/search?q=bobs", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusNotImplemented, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPINearby(t *testing.T) {
+	t.Parallel()
+
+	t.Run("found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			index   = search.NewIndex(0)
+			spatial = search.NewSpatialIndex(index)
+		)
+		establishments := []service.Establishment{
+			service.Establishment{
+				ID:      1,
+				Name:    "Bobs burgers",
+				Rating:  "5",
+				Geocode: service.Geocode{Latitude: 53.801, Longitude: -1.5, Valid: true},
+			},
+			service.Establishment{
+				ID:      2,
+				Name:    "Freds Pizzas",
+				Rating:  "3",
+				Geocode: service.Geocode{Latitude: 53.8, Longitude: -1.5, Valid: true},
+			},
+			service.Establishment{
+				ID:      3,
+				Name:    "Far away",
+				Rating:  "1",
+				Geocode: service.Geocode{Latitude: 54.8, Longitude: -1.5, Valid: true},
+			},
+		}
+		index.Add("1", establishments)
+		spatial.Add("1", establishments)
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger(), WithSpatialIndex(spatial))
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/nearby?lat=53.8&lng=-1.5&radius=500&limit=1", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var got OutputNearby
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, len(got.Establishments); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, got.Establishments[0].ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		// The ratings include every establishment with in the radius.
+		var names []string
+		for _, v := range got.Ratings {
+			names = append(names, v.Name)
+		}
+		if expected, actual := []string{"3-Star", "5-Star"}, names; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error invalid location", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger(), WithSpatialIndex(search.NewSpatialIndex(search.NewIndex(0))))
+			server = httptest.NewServer(api)
+		)
+		defer server.Close()
+
+		for _, query := range []string{
+			"",
+			"?lat=53.8",
+			"?lat=91&lng=0",
+			"?lat=53.8&lng=abc",
+			"?lat=53.8&lng=-1.5&radius=0",
+			"?lat=53.8&lng=-1.5&radius=50001",
+		} {
+			res, err := request(fmt.Sprintf("%s/nearby%s", server.URL, query))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected, actual := http.StatusBadRequest, res.StatusCode; expected != actual {
+				t.Errorf("%s: expected: %v, actual: %v", query, expected, actual)
+			}
+		}
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/nearby?lat=53.8&lng=-1.5", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusNotImplemented, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPICompare(t *testing.T) {
+	t.Parallel()
+
+	t.Run("aligned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/compare?local_id=1&local_id=2", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{
+				service.Establishment{Name: "Bobs burgers", Rating: "5"},
+				service.Establishment{Name: "Freds Pizzas", Rating: "4"},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "2").
+			Return([]service.Establishment{
+				service.Establishment{Name: "Alices Cafe", Rating: "5"},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var cmp OutputCompare
+		if err := json.NewDecoder(res.Body).Decode(&cmp); err != nil {
+			t.Fatal(err)
+		}
+
+		names := func(ratings []OutputRating) []string {
+			res := make([]string, len(ratings))
+			for k, v := range ratings {
+				res[k] = v.Name
+			}
+			return res
+		}
+		counts := func(ratings []OutputRating) []int {
+			res := make([]int, len(ratings))
+			for k, v := range ratings {
+				res[k] = v.Count
+			}
+			return res
+		}
+
+		if expected, actual := 3, cmp.Pooled.Total; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []int{1, 2}, counts(cmp.Pooled.Ratings); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, len(cmp.Authorities); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		for k, want := range []struct {
+			localID string
+			counts  []int
+		}{
+			{"1", []int{1, 1}},
+			{"2", []int{0, 1}},
+		} {
+			got := cmp.Authorities[k]
+			if expected, actual := want.localID, got.LocalID; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := []string{"4-Star", "5-Star"}, names(got.Ratings); !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := want.counts, counts(got.Ratings); !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/compare?local_id=1&local_id=2", server.URL)
+		)
+		defer server.Close()
+
+		// The failure cancels the other requests, so they might not happen.
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{}, nil).
+			AnyTimes()
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "2").
+			Return(nil, errors.New("something went wrong"))
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusInternalServerError, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error no local id", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/compare", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusBadRequest, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPIAggregate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("region", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/aggregate?level=region", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{
+				service.Authority{Name: "York", LocalID: 1, EstablishmentCount: 2, Region: "Yorkshire and Humberside"},
+				service.Authority{Name: "Leeds", LocalID: 2, EstablishmentCount: 1, Region: "Yorkshire and Humberside"},
+				service.Authority{Name: "Cardiff", LocalID: 3, EstablishmentCount: 1, Region: "Wales"},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{
+				service.Establishment{Name: "Bobs burgers", Rating: "5"},
+				service.Establishment{Name: "Freds Pizzas", Rating: "4"},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "2").
+			Return([]service.Establishment{
+				service.Establishment{Name: "Alices Cafe", Rating: "5"},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "3").
+			Return([]service.Establishment{
+				service.Establishment{Name: "Daves Diner", Rating: "3"},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var agg OutputAggregate
+		if err := json.NewDecoder(res.Body).Decode(&agg); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := AggregateRegion, agg.Level; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, len(agg.Groups); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+
+		wales, yorkshire := agg.Groups[0], agg.Groups[1]
+		if expected, actual := "Wales", wales.Name; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, wales.Total; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "Yorkshire and Humberside", yorkshire.Name; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, yorkshire.Authorities; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 3, yorkshire.Total; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, len(yorkshire.Ratings); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, yorkshire.Ratings[1].Count; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/aggregate?level=country&name=Narnia", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{
+				service.Authority{Name: "York", LocalID: 1, Region: "Yorkshire and Humberside"},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusNotFound, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error invalid level", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/aggregate?level=county", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusBadRequest, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPIRankings(t *testing.T) {
+	t.Parallel()
+
+	expect := func(mock *mock_service.MockService) {
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{
+				service.Authority{Name: "York", LocalID: 1},
+				service.Authority{Name: "Leeds", LocalID: 2},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{
+				service.Establishment{Rating: "5"},
+				service.Establishment{Rating: "1"},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "2").
+			Return([]service.Establishment{
+				service.Establishment{Rating: "5"},
+			}, nil)
+	}
+	localIDs := func(rankings []OutputRanking) []int {
+		res := make([]int, len(rankings))
+		for k, v := range rankings {
+			res[k] = v.LocalID
+		}
+		return res
+	}
+
+	t.Run("live", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/rankings?min_establishments=1", server.URL)
+		)
+		defer server.Close()
+
+		expect(mock)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var rankings OutputRankings
+		if err := json.NewDecoder(res.Body).Decode(&rankings); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := RankFiveStar, rankings.Metric; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "", rankings.Snapshot; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []int{2, 1}, localIDs(rankings.Rankings); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock     = mock_service.NewMockService(ctrl)
+			snapshot = NewRankingsSnapshot(mock, 2, log.NewNopLogger())
+			api      = NewAPI(mock, log.NewNopLogger(), WithRankingsSnapshot(snapshot))
+			server   = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/rankings?min_establishments=1&metric=two_star_or_below&limit=1", server.URL)
+		)
+		defer server.Close()
+
+		// Only the snapshot should request the service.
+		expect(mock)
+		if err := snapshot.Refresh(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			res, err := request(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected, actual := "0", res.Header.Get("Age"); expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+
+			var rankings OutputRankings
+			if err := json.NewDecoder(res.Body).Decode(&rankings); err != nil {
+				t.Fatal(err)
+			}
+			if rankings.Snapshot == "" {
+				t.Errorf("expected snapshot")
+			}
+			if expected, actual := []int{2}, localIDs(rankings.Rankings); !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("snapshot not ready", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock     = mock_service.NewMockService(ctrl)
+			snapshot = NewRankingsSnapshot(mock, 2, log.NewNopLogger())
+			api      = NewAPI(mock, log.NewNopLogger(), WithRankingsSnapshot(snapshot))
+			server   = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/rankings", server.URL)
+		)
+		defer server.Close()
+
+		// The service shouldn't be requested until the snapshot is taken.
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusServiceUnavailable, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "30", res.Header.Get("Retry-After"); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error invalid metric", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/rankings?metric=bad", server.URL)
+		)
+		defer server.Close()
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusBadRequest, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestAPIReferences(t *testing.T) {
+	t.Parallel()
+
+	t.Run("regions", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/regions", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			Regions(gomock.Any()).
+			Return([]service.Region{
+				service.Region{
+					ID:   1,
+					Name: "Yorkshire and Humberside",
+					Code: "YH",
+				},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusOK, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var refs []OutputReference
+		if err := json.NewDecoder(res.Body).Decode(&refs); err != nil {
+			t.Fatal(err)
+		}
+		want := []OutputReference{
+			OutputReference{
+				ID:   1,
+				Name: "Yorkshire and Humberside",
+				Code: "YH",
+			},
+		}
+		if expected, actual := want, refs; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("ratings", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/ratings", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			Ratings(gomock.Any()).
+			Return([]service.Rating{
+				service.Rating{
+					ID:           12,
+					Name:         "AwaitingInspection",
+					Key:          "fhrs_awaitinginspection_en-gb",
+					SchemeTypeID: 1,
+				},
+			}, nil)
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var refs []OutputReference
+		if err := json.NewDecoder(res.Body).Decode(&refs); err != nil {
+			t.Fatal(err)
+		}
+		want := []OutputReference{
+			OutputReference{
+				ID:           12,
+				Name:         "Awaiting Inspection",
+				Key:          "fhrs_awaitinginspection_en-gb",
+				SchemeTypeID: 1,
+			},
+		}
+		if expected, actual := want, refs; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = mock_service.NewMockService(ctrl)
+			api    = NewAPI(mock, log.NewNopLogger())
+			server = httptest.NewServer(api)
+
+			u = fmt.Sprintf("%s/businesstypes", server.URL)
+		)
+		defer server.Close()
+
+		mock.EXPECT().
+			BusinessTypes(gomock.Any()).
+			Return(nil, errors.New("something went wrong"))
+
+		res, err := request(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := http.StatusInternalServerError, res.StatusCode; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
 }
 
 func request(u string) (*http.Response, error) {
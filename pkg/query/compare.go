@@ -0,0 +1,143 @@
+package query
+
+import (
+	"context"
+	"sync"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+	"github.com/pkg/errors"
+)
+
+// countAuthorities counts the ratings of the establishments for each of the
+// authorities that match the filters. The counters are returned in the same
+// order as the local ids. If any of the authorities fail, then the rest are
+// cancelled and the error is returned.
+func countAuthorities(ctx context.Context, s service.Service, localIDs []string, filters EstablishmentsFilters, concurrency int) ([]*ratingsCounter, error) {
+	counters := make([]*ratingsCounter, len(localIDs))
+	if err := forEachAuthority(ctx, localIDs, concurrency, func(ctx context.Context, k int, localID string) error {
+		counter, err := countAuthority(ctx, s, localID, filters)
+		if err != nil {
+			return err
+		}
+		counters[k] = counter
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
+
+// countAuthority counts the ratings of the establishments for the authority
+// that match the filters.
+func countAuthority(ctx context.Context, s service.Service, localID string, filters EstablishmentsFilters) (*ratingsCounter, error) {
+	counter := newRatingsCounter()
+	if err := service.StreamEstablishmentsForAuthority(ctx, s, localID, func(e service.Establishment) error {
+		if filters.match(e) {
+			counter.Add(e)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "error requesting establishments for authority %q", localID)
+	}
+	return counter, nil
+}
+
+// forEachAuthority calls fn for each of the local ids concurrently, with at
+// most concurrency calls in-flight at once. If fn returns an error, then the
+// rest are cancelled and the first error is returned.
+func forEachAuthority(ctx context.Context, localIDs []string, concurrency int, fn func(context.Context, int, string) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg        sync.WaitGroup
+		once      sync.Once
+		failure   error
+		semaphore = make(chan struct{}, concurrency)
+	)
+	for k, localID := range localIDs {
+		wg.Add(1)
+		go func(k int, localID string) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				return
+			}
+
+			if err := fn(ctx, k, localID); err != nil {
+				once.Do(func() {
+					failure = err
+					cancel()
+				})
+			}
+		}(k, localID)
+	}
+	wg.Wait()
+
+	if failure != nil {
+		return failure
+	}
+	// The caller went away before everything was done.
+	return ctx.Err()
+}
+
+// Comparison is the ratings of the authorities aligned to the same names, along
+// with the pooled ratings of all the authorities together.
+type Comparison struct {
+	Authorities []ComparisonRatings
+	Pooled      ComparisonRatings
+}
+
+// ComparisonRatings is the ratings of a single authority, or of the pool of
+// authorities (in which case there is no LocalID).
+type ComparisonRatings struct {
+	LocalID string
+	Scheme  Scheme
+	Total   int
+	Ratings []Rating
+}
+
+// compare aligns the ratings of the counters, so that every authority has the
+// same rating names in the same order as the pooled ratings.
+func compare(localIDs []string, counters []*ratingsCounter, order SortOrder) Comparison {
+	pooled := newRatingsCounter()
+	for _, v := range counters {
+		pooled.Merge(v)
+	}
+
+	var (
+		scheme  = pooled.Scheme()
+		ratings = pooled.Ratings()
+	)
+	sortRatings(ratings, scheme, order)
+
+	names := make([]string, len(ratings))
+	for k, v := range ratings {
+		names[k] = v.Name
+	}
+
+	res := Comparison{
+		Authorities: make([]ComparisonRatings, len(counters)),
+		Pooled: ComparisonRatings{
+			Scheme:  scheme,
+			Total:   pooled.total,
+			Ratings: ratings,
+		},
+	}
+	for k, v := range counters {
+		res.Authorities[k] = ComparisonRatings{
+			LocalID: localIDs[k],
+			Scheme:  v.Scheme(),
+			Total:   v.total,
+			Ratings: v.Aligned(names),
+		}
+	}
+	return res
+}
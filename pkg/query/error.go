@@ -2,7 +2,10 @@ package query
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+
+	"github.com/pkg/errors"
 )
 
 // JSONError replies to the request with the specified error message and HTTP
@@ -10,16 +13,59 @@ import (
 // further writes are done to w.
 // The error message should be json compatible otherwise this will panic.
 func JSONError(w http.ResponseWriter, err string, code int) {
+	writeError(w, rawError{
+		Error: err,
+		Code:  code,
+	})
+}
+
+// JSONParamError replies to the request in the same way as JSONError, but also
+// names the query parameter that caused the error, so that the client can
+// report it against the right input.
+func JSONParamError(w http.ResponseWriter, param, err string, code int) {
+	writeError(w, rawError{
+		Error: err,
+		Code:  code,
+		Param: param,
+	})
+}
+
+// ParamError is returned when a query parameter can't be read or parsed.
+type ParamError struct {
+	Param   string
+	Message string
+}
+
+func (e *ParamError) Error() string {
+	return e.Message
+}
+
+// paramErrorf returns a ParamError for the param, formatting the message.
+func paramErrorf(param, format string, args ...interface{}) error {
+	return &ParamError{
+		Param:   param,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// queryError replies to the request with a bad request, naming the query
+// parameter if the error is a ParamError.
+func queryError(w http.ResponseWriter, err error) {
+	if e, ok := errors.Cause(err).(*ParamError); ok {
+		JSONParamError(w, e.Param, err.Error(), http.StatusBadRequest)
+		return
+	}
+	JSONError(w, err.Error(), http.StatusBadRequest)
+}
+
+func writeError(w http.ResponseWriter, raw rawError) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
-	w.WriteHeader(code)
+	w.WriteHeader(raw.Code)
 
 	// Note: it's possible that this can fail and therefore we panic.
-	if e := json.NewEncoder(w).Encode(rawError{
-		Error: err,
-		Code:  code,
-	}); e != nil {
+	if e := json.NewEncoder(w).Encode(raw); e != nil {
 		panic(e)
 	}
 }
@@ -27,4 +73,5 @@ func JSONError(w http.ResponseWriter, err string, code int) {
 type rawError struct {
 	Error string `json:"error"`
 	Code  int    `json:"code"`
+	Param string `json:"param,omitempty"`
 }
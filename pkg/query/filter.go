@@ -0,0 +1,67 @@
+package query
+
+import (
+	"strings"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+// match returns true if the establishment matches all the filters.
+// Establishments with out a rating date never match a rating date range, as
+// they've not been rated.
+func (p EstablishmentsFilters) match(e service.Establishment) bool {
+	if p.BusinessType != 0 && e.BusinessTypeID != p.BusinessType {
+		return false
+	}
+	if p.Scheme != SchemeUnknown && schemeOf(e) != p.Scheme {
+		return false
+	}
+	if !p.RatingFrom.IsZero() || !p.RatingTo.IsZero() {
+		date := e.RatingDate.Time
+		if date.IsZero() {
+			return false
+		}
+		if !p.RatingFrom.IsZero() && date.Before(p.RatingFrom) {
+			return false
+		}
+		// The range is inclusive of the whole of the last day.
+		if !p.RatingTo.IsZero() && !date.Before(p.RatingTo.AddDate(0, 0, 1)) {
+			return false
+		}
+	}
+	if p.District != "" && postcodeDistrict(e.PostCode) != p.District {
+		return false
+	}
+	if p.ExcludeAwaiting && normalizeRating(e.Rating) == "awaitinginspection" {
+		return false
+	}
+	return true
+}
+
+// postcodeDistrict returns the district (outward code) of the postcode i.e.
+// "YO1" for "YO1 7HH". The inward code is always the last 3 characters, so the
+// postcode doesn't have to be spaced correctly.
+func postcodeDistrict(postcode string) string {
+	compact := strings.ToUpper(strings.Replace(postcode, " ", "", -1))
+	if len(compact) < 5 {
+		return ""
+	}
+	return compact[:len(compact)-3]
+}
+
+// validDistrict returns true if the district looks like the outward code of a
+// postcode, which is 2 to 4 characters, starting with a letter.
+func validDistrict(district string) bool {
+	if len(district) < 2 || len(district) > 4 {
+		return false
+	}
+	for k, r := range district {
+		switch {
+		case r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && k > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+func TestEstablishmentsFiltersMatch(t *testing.T) {
+	t.Parallel()
+
+	var (
+		date = func(year int, month time.Month, day, hour int) service.Date {
+			return service.Date{Time: time.Date(year, month, day, hour, 0, 0, 0, time.UTC)}
+		}
+		from = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		to   = time.Date(2017, 12, 31, 0, 0, 0, 0, time.UTC)
+	)
+
+	for _, test := range []struct {
+		name          string
+		params        EstablishmentsFilters
+		establishment service.Establishment
+		match         bool
+	}{
+		{"no filters", EstablishmentsFilters{}, service.Establishment{Rating: "5"}, true},
+		{"business type", EstablishmentsFilters{BusinessType: 1}, service.Establishment{BusinessTypeID: 1}, true},
+		{"other business type", EstablishmentsFilters{BusinessType: 1}, service.Establishment{BusinessTypeID: 7843}, false},
+		{"scheme", EstablishmentsFilters{Scheme: SchemeFHIS}, service.Establishment{Rating: "Pass"}, true},
+		{"other scheme", EstablishmentsFilters{Scheme: SchemeFHIS}, service.Establishment{Rating: "5"}, false},
+		{"rating date", EstablishmentsFilters{RatingFrom: from, RatingTo: to}, service.Establishment{RatingDate: date(2017, 6, 1, 0)}, true},
+		{"rating date last day", EstablishmentsFilters{RatingTo: to}, service.Establishment{RatingDate: date(2017, 12, 31, 12)}, true},
+		{"rating date before", EstablishmentsFilters{RatingFrom: from}, service.Establishment{RatingDate: date(2016, 12, 31, 23)}, false},
+		{"rating date after", EstablishmentsFilters{RatingTo: to}, service.Establishment{RatingDate: date(2018, 1, 1, 0)}, false},
+		{"no rating date", EstablishmentsFilters{RatingFrom: from}, service.Establishment{}, false},
+		{"district", EstablishmentsFilters{District: "YO1"}, service.Establishment{PostCode: "yo1 7hh"}, true},
+		{"district unspaced", EstablishmentsFilters{District: "YO1"}, service.Establishment{PostCode: "YO17HH"}, true},
+		{"other district", EstablishmentsFilters{District: "YO1"}, service.Establishment{PostCode: "YO10 3DD"}, false},
+		{"awaiting", EstablishmentsFilters{ExcludeAwaiting: true}, service.Establishment{Rating: "AwaitingInspection"}, false},
+		{"awaiting publication", EstablishmentsFilters{ExcludeAwaiting: true}, service.Establishment{Rating: "AwaitingPublication"}, true},
+	} {
+		if expected, actual := test.match, test.params.match(test.establishment); expected != actual {
+			t.Errorf("%s: expected: %v, actual: %v", test.name, expected, actual)
+		}
+	}
+}
+
+func TestPostcodeDistrict(t *testing.T) {
+	t.Parallel()
+
+	for postcode, district := range map[string]string{
+		"YO1 7HH":  "YO1",
+		"yo10 3dd": "YO10",
+		"EC1A1BB":  "EC1A",
+		"M1 1AE":   "M1",
+		"":         "",
+		"YO1":      "",
+	} {
+		if expected, actual := district, postcodeDistrict(postcode); expected != actual {
+			t.Errorf("%s: expected: %q, actual: %q", postcode, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package query
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+	"github.com/pkg/errors"
+)
+
+// cursor marks the position of the last establishment of a page, so that the
+// next page can carry on from where it left off. As the establishments are
+// always in the same order, the cursor remains valid even if establishments
+// are added or removed between requests.
+type cursor struct {
+	Name string
+	ID   int
+}
+
+// encodeCursor returns an opaque cursor for the establishment.
+func encodeCursor(establishment service.Establishment) string {
+	value := strconv.Itoa(establishment.ID) + ":" + establishment.Name
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// decodeCursor decodes a cursor previously returned by encodeCursor.
+func decodeCursor(value string) (cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor{}, errors.Wrap(err, "invalid cursor")
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return cursor{}, errors.Wrap(err, "invalid cursor")
+	}
+	return cursor{
+		Name: parts[1],
+		ID:   id,
+	}, nil
+}
+
+// after returns if the establishment is ordered after the cursor.
+func (c cursor) after(establishment service.Establishment) bool {
+	if establishment.Name != c.Name {
+		return establishment.Name > c.Name
+	}
+	return establishment.ID > c.ID
+}
+
+// listEstablishments filters the establishments and returns the page of them
+// after the cursor, along with the cursor for the next page if there is one.
+// The establishments are sorted by name and then by id, so that the order is
+// stable between requests.
+func listEstablishments(establishments []service.Establishment, p EstablishmentsListQueryParams) ([]service.Establishment, string) {
+	var (
+		rating = normalizeRating(ratingName(p.Rating))
+		name   = strings.ToLower(p.Name)
+		res    = make([]service.Establishment, 0)
+	)
+	for _, v := range establishments {
+		if p.Rating != "" && normalizeRating(schemeOf(v).ratingName(v.Rating)) != rating {
+			continue
+		}
+		if name != "" && !strings.Contains(strings.ToLower(v.Name), name) {
+			continue
+		}
+		if !p.match(v) {
+			continue
+		}
+		if p.Cursor != nil && !p.Cursor.after(v) {
+			continue
+		}
+		res = append(res, v)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].ID < res[j].ID
+	})
+
+	if len(res) <= p.Limit {
+		return res, ""
+	}
+	res = res[:p.Limit]
+	return res, encodeCursor(res[len(res)-1])
+}
@@ -0,0 +1,101 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+func TestCursor(t *testing.T) {
+	t.Parallel()
+
+	e := service.Establishment{ID: 123, Name: "Bobs: burgers"}
+	c, err := decodeCursor(encodeCursor(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := (cursor{Name: e.Name, ID: e.ID}), c; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	for _, value := range []string{"!!!", "MTIz", "YWJjOmRlZg"} {
+		if _, err := decodeCursor(value); err == nil {
+			t.Errorf("%s: expected error", value)
+		}
+	}
+}
+
+func TestListEstablishments(t *testing.T) {
+	t.Parallel()
+
+	establishments := []service.Establishment{
+		service.Establishment{ID: 4, Name: "Freds Pizzas", Rating: "5"},
+		service.Establishment{ID: 3, Name: "Bobs burgers", Rating: "3"},
+		service.Establishment{ID: 1, Name: "Bobs burgers", Rating: "5"},
+		service.Establishment{ID: 2, Name: "Alices Cafe", Rating: "Exempt"},
+		service.Establishment{ID: 5, Name: "Bobs Bakery", Rating: "Pass"},
+	}
+	ids := func(establishments []service.Establishment) []int {
+		res := make([]int, len(establishments))
+		for k, v := range establishments {
+			res[k] = v.ID
+		}
+		return res
+	}
+
+	t.Run("sorted", func(t *testing.T) {
+		got, next := listEstablishments(establishments, EstablishmentsListQueryParams{Limit: 10})
+		if expected, actual := []int{2, 5, 1, 3, 4}, ids(got); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "", next; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		for _, test := range []struct {
+			rating, name string
+			want         []int
+		}{
+			{"5", "", []int{1, 4}},
+			{"5-Star", "", []int{1, 4}},
+			{"pass", "", []int{5}},
+			{"", "BOBS", []int{5, 1, 3}},
+			{"5", "bobs", []int{1}},
+			{"0", "", []int{}},
+		} {
+			got, _ := listEstablishments(establishments, EstablishmentsListQueryParams{
+				Rating: test.rating,
+				Name:   test.name,
+				Limit:  10,
+			})
+			if expected, actual := test.want, ids(got); !reflect.DeepEqual(expected, actual) {
+				t.Errorf("%q %q: expected: %v, actual: %v", test.rating, test.name, expected, actual)
+			}
+		}
+	})
+
+	t.Run("paged", func(t *testing.T) {
+		var (
+			got []int
+			p   = EstablishmentsListQueryParams{Limit: 2}
+		)
+		for {
+			page, next := listEstablishments(establishments, p)
+			got = append(got, ids(page)...)
+			if next == "" {
+				break
+			}
+			c, err := decodeCursor(next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Cursor = &c
+		}
+		if expected, actual := []int{2, 5, 1, 3, 4}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
@@ -2,13 +2,46 @@ package query
 
 import (
 	"net/url"
-
-	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// EstablishmentsQueryParams defines all the dimensions of a query.
+// AuthoritiesQueryParams defines all the dimensions of a query for the
+// authorities.
+type AuthoritiesQueryParams struct {
+	Region string
+}
+
+// DecodeFrom populates a AuthoritiesQueryParams from a URL.
+func (p *AuthoritiesQueryParams) DecodeFrom(u *url.URL, rb queryBehavior) error {
+	p.Region = u.Query().Get("region")
+	if p.Region == "" && rb == queryRequired {
+		return paramErrorf("region", "error reading/parsing 'region' (required) query")
+	}
+	return nil
+}
+
+// queryDateLayout is the layout of the dates with in a query.
+const queryDateLayout = "2006-01-02"
+
+// EstablishmentsQueryParams defines all the dimensions of a query. Apart from
+// the LocalID, the dimensions are optional.
 type EstablishmentsQueryParams struct {
 	LocalID string
+	Sort    SortOrder
+	Stats   bool
+	EstablishmentsFilters
+}
+
+// EstablishmentsFilters defines the optional filters of the establishments.
+type EstablishmentsFilters struct {
+	BusinessType    int
+	Scheme          Scheme
+	RatingFrom      time.Time
+	RatingTo        time.Time
+	District        string
+	ExcludeAwaiting bool
 }
 
 // DecodeFrom populates a EstablishmentsQueryParams from a URL.
@@ -16,7 +49,405 @@ func (p *EstablishmentsQueryParams) DecodeFrom(u *url.URL, rb queryBehavior) err
 	// Required depending on the query behavior
 	p.LocalID = u.Query().Get("local_id")
 	if p.LocalID == "" && rb == queryRequired {
-		return errors.New("error reading/parsing 'local_id' (required) query")
+		return paramErrorf("local_id", "error reading/parsing 'local_id' (required) query")
+	}
+
+	// Optional, defaults to the canonical order of the scheme.
+	p.Sort = SortCanonical
+	if sort := u.Query().Get("sort"); sort != "" {
+		if p.Sort = SortOrder(sort); !p.Sort.valid() {
+			return paramErrorf("sort", "error reading/parsing 'sort' (%q) query", sort)
+		}
+	}
+
+	// Optional, the stats are only returned if they're asked for.
+	p.Stats = false
+	if value := u.Query().Get("stats"); value != "" {
+		stats, err := strconv.ParseBool(value)
+		if err != nil {
+			return paramErrorf("stats", "error reading/parsing 'stats' (%q) query", value)
+		}
+		p.Stats = stats
+	}
+
+	return p.EstablishmentsFilters.decode(u.Query())
+}
+
+// decode populates the EstablishmentsFilters from the query values.
+func (p *EstablishmentsFilters) decode(q url.Values) error {
+	p.BusinessType = 0
+	if value := q.Get("business_type"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 0 {
+			return paramErrorf("business_type", "error reading/parsing 'business_type' (%q) query", value)
+		}
+		p.BusinessType = id
+	}
+
+	p.Scheme = SchemeUnknown
+	if value := q.Get("scheme"); value != "" {
+		switch scheme := Scheme(strings.ToUpper(value)); scheme {
+		case SchemeFHRS, SchemeFHIS:
+			p.Scheme = scheme
+		default:
+			return paramErrorf("scheme", "error reading/parsing 'scheme' (%q) query, expected %s or %s", value, SchemeFHRS, SchemeFHIS)
+		}
+	}
+
+	for _, v := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{"rating_from", &p.RatingFrom},
+		{"rating_to", &p.RatingTo},
+	} {
+		*v.value = time.Time{}
+		value := q.Get(v.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(queryDateLayout, value)
+		if err != nil {
+			return paramErrorf(v.name, "error reading/parsing '%s' (%q) query, expected %s", v.name, value, queryDateLayout)
+		}
+		*v.value = t
+	}
+	if !p.RatingFrom.IsZero() && !p.RatingTo.IsZero() && p.RatingTo.Before(p.RatingFrom) {
+		return paramErrorf("rating_to", "error reading/parsing 'rating_to' (%q) query, expected on or after 'rating_from'", q.Get("rating_to"))
+	}
+
+	p.District = ""
+	if value := q.Get("district"); value != "" {
+		district := strings.ToUpper(strings.Replace(value, " ", "", -1))
+		if !validDistrict(district) {
+			return paramErrorf("district", "error reading/parsing 'district' (%q) query", value)
+		}
+		p.District = district
+	}
+
+	p.ExcludeAwaiting = false
+	if value := q.Get("exclude_awaiting"); value != "" {
+		exclude, err := strconv.ParseBool(value)
+		if err != nil {
+			return paramErrorf("exclude_awaiting", "error reading/parsing 'exclude_awaiting' (%q) query", value)
+		}
+		p.ExcludeAwaiting = exclude
+	}
+	return nil
+}
+
+// EstablishmentQueryParams defines all the dimensions of a query for a single
+// establishment.
+type EstablishmentQueryParams struct {
+	ID int
+}
+
+// DecodeFrom populates a EstablishmentQueryParams from a URL.
+func (p *EstablishmentQueryParams) DecodeFrom(u *url.URL, rb queryBehavior) error {
+	// Required depending on the query behavior
+	value := u.Query().Get("id")
+	if value == "" {
+		if rb == queryRequired {
+			return paramErrorf("id", "error reading/parsing 'id' (required) query")
+		}
+		return nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		return paramErrorf("id", "error reading/parsing 'id' (%q) query", value)
+	}
+	p.ID = id
+	return nil
+}
+
+// maxCompareAuthorities is the maximum number of authorities that can be
+// compared in one query.
+const maxCompareAuthorities = 10
+
+// CompareQueryParams defines all the dimensions of a query comparing the
+// ratings of authorities.
+type CompareQueryParams struct {
+	LocalIDs []string
+	Sort     SortOrder
+	EstablishmentsFilters
+}
+
+// DecodeFrom populates a CompareQueryParams from a URL.
+func (p *CompareQueryParams) DecodeFrom(u *url.URL, rb queryBehavior) error {
+	q := u.Query()
+
+	// Required depending on the query behavior, duplicates are ignored so that
+	// the same authority isn't requested twice.
+	var (
+		ids  = make([]string, 0)
+		seen = map[string]struct{}{}
+	)
+	for _, v := range q["local_id"] {
+		if _, ok := seen[v]; v == "" || ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		ids = append(ids, v)
+	}
+	if len(ids) == 0 && rb == queryRequired {
+		return paramErrorf("local_id", "error reading/parsing 'local_id' (required) query")
+	}
+	if len(ids) > maxCompareAuthorities {
+		return paramErrorf("local_id", "error reading/parsing 'local_id' query, expected up to %d", maxCompareAuthorities)
+	}
+	p.LocalIDs = ids
+
+	// Optional, defaults to the canonical order of the scheme.
+	p.Sort = SortCanonical
+	if sort := q.Get("sort"); sort != "" {
+		if p.Sort = SortOrder(sort); !p.Sort.valid() {
+			return paramErrorf("sort", "error reading/parsing 'sort' (%q) query", sort)
+		}
+	}
+
+	return p.EstablishmentsFilters.decode(q)
+}
+
+// AggregateQueryParams defines all the dimensions of a query aggregating the
+// ratings of groups of authorities.
+type AggregateQueryParams struct {
+	Level AggregateLevel
+	Name  string
+	Sort  SortOrder
+	EstablishmentsFilters
+}
+
+// DecodeFrom populates a AggregateQueryParams from a URL.
+func (p *AggregateQueryParams) DecodeFrom(u *url.URL, rb queryBehavior) error {
+	q := u.Query()
+
+	// Required depending on the query behavior
+	p.Level = AggregateLevel(strings.ToLower(q.Get("level")))
+	if p.Level == "" {
+		if rb == queryRequired {
+			return paramErrorf("level", "error reading/parsing 'level' (required) query")
+		}
+	} else if !p.Level.valid() {
+		return paramErrorf("level", "error reading/parsing 'level' (%q) query, expected %s, %s or %s", q.Get("level"), AggregateRegion, AggregateCountry, AggregateNational)
+	}
+
+	// Optional, selects a single group by name i.e. "Wales"
+	p.Name = strings.TrimSpace(q.Get("name"))
+
+	// Optional, defaults to the canonical order of the scheme.
+	p.Sort = SortCanonical
+	if sort := q.Get("sort"); sort != "" {
+		if p.Sort = SortOrder(sort); !p.Sort.valid() {
+			return paramErrorf("sort", "error reading/parsing 'sort' (%q) query", sort)
+		}
+	}
+
+	return p.EstablishmentsFilters.decode(q)
+}
+
+// These are the defaults of the rankings.
+const (
+	defaultRankingsMetric = RankFiveStar
+	defaultRankingsMin    = 10
+)
+
+// RankingsQueryParams defines all the dimensions of a query ranking the
+// authorities.
+type RankingsQueryParams struct {
+	Metric            RankingMetric
+	MinEstablishments int
+	Limit             int
+}
+
+// DecodeFrom populates a RankingsQueryParams from a URL. Every dimension is
+// optional, so the query behavior doesn't apply.
+func (p *RankingsQueryParams) DecodeFrom(u *url.URL, rb queryBehavior) error {
+	q := u.Query()
+
+	p.Metric = defaultRankingsMetric
+	if value := q.Get("metric"); value != "" {
+		if p.Metric = RankingMetric(value); !p.Metric.valid() {
+			return paramErrorf("metric", "error reading/parsing 'metric' (%q) query, expected %s, %s or %s", value, RankFiveStar, RankTwoStarOrBelow, RankMeanScore)
+		}
+	}
+
+	p.MinEstablishments = defaultRankingsMin
+	if value := q.Get("min_establishments"); value != "" {
+		min, err := strconv.Atoi(value)
+		if err != nil || min < 1 {
+			return paramErrorf("min_establishments", "error reading/parsing 'min_establishments' (%q) query, expected 1 or more", value)
+		}
+		p.MinEstablishments = min
+	}
+
+	// Optional, every authority is returned with out a limit.
+	p.Limit = 0
+	if value := q.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return paramErrorf("limit", "error reading/parsing 'limit' (%q) query, expected 1 or more", value)
+		}
+		p.Limit = limit
+	}
+	return nil
+}
+
+// These are the limits of the search results.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchQueryParams defines all the dimensions of a search query.
+type SearchQueryParams struct {
+	Query string
+	Limit int
+}
+
+// DecodeFrom populates a SearchQueryParams from a URL.
+func (p *SearchQueryParams) DecodeFrom(u *url.URL, rb queryBehavior) error {
+	q := u.Query()
+
+	// Required depending on the query behavior
+	p.Query = strings.TrimSpace(q.Get("q"))
+	if p.Query == "" && rb == queryRequired {
+		return paramErrorf("q", "error reading/parsing 'q' (required) query")
+	}
+
+	p.Limit = defaultSearchLimit
+	if value := q.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			return paramErrorf("limit", "error reading/parsing 'limit' (%q) query, expected 1 to %d", value, maxSearchLimit)
+		}
+		p.Limit = limit
+	}
+	return nil
+}
+
+// These are the limits of the nearby query, the radius is in metres.
+const (
+	defaultNearbyRadius = 1000
+	maxNearbyRadius     = 50000
+	defaultNearbyLimit  = 50
+	maxNearbyLimit      = 500
+)
+
+// NearbyQueryParams defines all the dimensions of a nearby query.
+type NearbyQueryParams struct {
+	Latitude  float64
+	Longitude float64
+	Radius    float64
+	Limit     int
+}
+
+// DecodeFrom populates a NearbyQueryParams from a URL.
+func (p *NearbyQueryParams) DecodeFrom(u *url.URL, rb queryBehavior) error {
+	q := u.Query()
+
+	// Required depending on the query behavior
+	for _, v := range []struct {
+		name     string
+		value    *float64
+		min, max float64
+	}{
+		{"lat", &p.Latitude, -90, 90},
+		{"lng", &p.Longitude, -180, 180},
+	} {
+		value := q.Get(v.name)
+		if value == "" {
+			if rb == queryRequired {
+				return paramErrorf(v.name, "error reading/parsing '%s' (required) query", v.name)
+			}
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < v.min || f > v.max {
+			return paramErrorf(v.name, "error reading/parsing '%s' (%q) query, expected %v to %v", v.name, value, v.min, v.max)
+		}
+		*v.value = f
+	}
+
+	p.Radius = defaultNearbyRadius
+	if value := q.Get("radius"); value != "" {
+		radius, err := strconv.ParseFloat(value, 64)
+		if err != nil || radius <= 0 || radius > maxNearbyRadius {
+			return paramErrorf("radius", "error reading/parsing 'radius' (%q) query, expected metres up to %d", value, maxNearbyRadius)
+		}
+		p.Radius = radius
+	}
+
+	p.Limit = defaultNearbyLimit
+	if value := q.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxNearbyLimit {
+			return paramErrorf("limit", "error reading/parsing 'limit' (%q) query, expected 1 to %d", value, maxNearbyLimit)
+		}
+		p.Limit = limit
+	}
+	return nil
+}
+
+// These are the limits of the establishments list.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// EstablishmentsListQueryParams defines all the dimensions of a query for the
+// list of establishments. Apart from the LocalID, the dimensions are optional.
+type EstablishmentsListQueryParams struct {
+	LocalID string
+	EstablishmentsFilters
+	Rating string
+	Name   string
+	Cursor *cursor
+	Limit  int
+}
+
+// DecodeFrom populates a EstablishmentsListQueryParams from a URL.
+func (p *EstablishmentsListQueryParams) DecodeFrom(u *url.URL, rb queryBehavior) error {
+	q := u.Query()
+
+	// The list is always ordered by name and doesn't have any stats, so these
+	// are rejected rather than silently ignored.
+	for _, name := range []string{"sort", "stats"} {
+		if _, ok := q[name]; ok {
+			return paramErrorf(name, "error reading/parsing '%s' query, not supported when listing establishments", name)
+		}
+	}
+
+	// Required depending on the query behavior
+	p.LocalID = q.Get("local_id")
+	if p.LocalID == "" && rb == queryRequired {
+		return paramErrorf("local_id", "error reading/parsing 'local_id' (required) query")
+	}
+
+	if err := p.EstablishmentsFilters.decode(q); err != nil {
+		return err
+	}
+
+	// Optional filters
+	p.Rating = q.Get("rating")
+	p.Name = q.Get("name")
+
+	p.Cursor = nil
+	if value := q.Get("cursor"); value != "" {
+		c, err := decodeCursor(value)
+		if err != nil {
+			return paramErrorf("cursor", "error reading/parsing 'cursor' (%q) query: %v", value, err)
+		}
+		p.Cursor = &c
+	}
+
+	p.Limit = defaultListLimit
+	if value := q.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return paramErrorf("limit", "error reading/parsing 'limit' (%q) query, expected 1 to %d", value, maxListLimit)
+		}
+		p.Limit = limit
 	}
 	return nil
 }
@@ -7,6 +7,9 @@ import (
 	"reflect"
 	"testing"
 	"testing/quick"
+	"time"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
 )
 
 func TestEstablishmentsQueryParams(t *testing.T) {
@@ -60,6 +63,311 @@ func TestEstablishmentsQueryParams(t *testing.T) {
 			t.Errorf("expected error")
 		}
 	})
+
+	t.Run("decode sort", func(t *testing.T) {
+		for _, test := range []struct {
+			query string
+			sort  SortOrder
+		}{
+			{"local_id=1", SortCanonical},
+			{"local_id=1&sort=name", SortName},
+			{"local_id=1&sort=percentage", SortPercentage},
+		} {
+			var (
+				qp     EstablishmentsQueryParams
+				u, err = url.Parse(fmt.Sprintf("http://example.com?%s", test.query))
+			)
+			if err != nil {
+				t.Error(err)
+			}
+			if err := qp.DecodeFrom(u, queryRequired); err != nil {
+				t.Error(err)
+			}
+			if expected, actual := test.sort, qp.Sort; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("decode invalid sort", func(t *testing.T) {
+		var (
+			qp     EstablishmentsQueryParams
+			u, err = url.Parse("http://example.com?local_id=1&sort=bad")
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := qp.DecodeFrom(u, queryRequired); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("decode filters", func(t *testing.T) {
+		var (
+			qp     EstablishmentsQueryParams
+			u, err = url.Parse("http://example.com?local_id=1&business_type=7843&scheme=fhis&rating_from=2017-01-01&rating_to=2017-12-31&district=yo1&exclude_awaiting=true")
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := qp.DecodeFrom(u, queryRequired); err != nil {
+			t.Fatal(err)
+		}
+
+		want := EstablishmentsQueryParams{
+			LocalID: "1",
+			Sort:    SortCanonical,
+			EstablishmentsFilters: EstablishmentsFilters{
+				BusinessType:    7843,
+				Scheme:          SchemeFHIS,
+				RatingFrom:      time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+				RatingTo:        time.Date(2017, 12, 31, 0, 0, 0, 0, time.UTC),
+				District:        "YO1",
+				ExcludeAwaiting: true,
+			},
+		}
+		if expected, actual := want, qp; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("decode invalid filters", func(t *testing.T) {
+		for _, test := range []struct {
+			query, param string
+		}{
+			{"business_type=bad", "business_type"},
+			{"scheme=bad", "scheme"},
+			{"rating_from=01/01/2017", "rating_from"},
+			{"rating_to=bad", "rating_to"},
+			{"rating_from=2017-12-31&rating_to=2017-01-01", "rating_to"},
+			{"district=1YO", "district"},
+			{"district=YO17HH", "district"},
+			{"exclude_awaiting=maybe", "exclude_awaiting"},
+		} {
+			var (
+				qp     EstablishmentsQueryParams
+				u, err = url.Parse("http://example.com?local_id=1&" + test.query)
+			)
+			if err != nil {
+				t.Error(err)
+			}
+			err = qp.DecodeFrom(u, queryRequired)
+			e, ok := err.(*ParamError)
+			if !ok {
+				t.Errorf("%s: expected param error, actual: %v", test.query, err)
+				continue
+			}
+			if expected, actual := test.param, e.Param; expected != actual {
+				t.Errorf("%s: expected: %v, actual: %v", test.query, expected, actual)
+			}
+		}
+	})
+}
+
+func TestCompareQueryParams(t *testing.T) {
+	t.Parallel()
+
+	t.Run("decode", func(t *testing.T) {
+		var (
+			qp     CompareQueryParams
+			u, err = url.Parse("http://example.com?local_id=1&local_id=2&local_id=1&local_id=&scheme=fhrs")
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := qp.DecodeFrom(u, queryRequired); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []string{"1", "2"}, qp.LocalIDs; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := SchemeFHRS, qp.Scheme; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("decode required", func(t *testing.T) {
+		var (
+			qp     CompareQueryParams
+			u, err = url.Parse("http://example.com")
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := qp.DecodeFrom(u, queryRequired); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("decode too many", func(t *testing.T) {
+		values := url.Values{}
+		for i := 0; i <= maxCompareAuthorities; i++ {
+			values.Add("local_id", fmt.Sprintf("%d", i))
+		}
+
+		var (
+			qp     CompareQueryParams
+			u, err = url.Parse("http://example.com?" + values.Encode())
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := qp.DecodeFrom(u, queryRequired); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+func TestAggregateQueryParams(t *testing.T) {
+	t.Parallel()
+
+	t.Run("decode", func(t *testing.T) {
+		var (
+			qp     AggregateQueryParams
+			u, err = url.Parse("http://example.com?level=Country&name=Wales&exclude_awaiting=1")
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := qp.DecodeFrom(u, queryRequired); err != nil {
+			t.Fatal(err)
+		}
+
+		want := AggregateQueryParams{
+			Level: AggregateCountry,
+			Name:  "Wales",
+			Sort:  SortCanonical,
+			EstablishmentsFilters: EstablishmentsFilters{
+				ExcludeAwaiting: true,
+			},
+		}
+		if expected, actual := want, qp; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("decode invalid", func(t *testing.T) {
+		for _, query := range []string{"", "level=county", "level=region&sort=bad"} {
+			var (
+				qp     AggregateQueryParams
+				u, err = url.Parse("http://example.com?" + query)
+			)
+			if err != nil {
+				t.Error(err)
+			}
+			if err := qp.DecodeFrom(u, queryRequired); err == nil {
+				t.Errorf("%s: expected error", query)
+			}
+		}
+	})
+}
+
+func TestRankingsQueryParams(t *testing.T) {
+	t.Parallel()
+
+	t.Run("decode defaults", func(t *testing.T) {
+		var (
+			qp     RankingsQueryParams
+			u, err = url.Parse("http://example.com")
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := qp.DecodeFrom(u, queryOptional); err != nil {
+			t.Fatal(err)
+		}
+
+		want := RankingsQueryParams{
+			Metric:            RankFiveStar,
+			MinEstablishments: defaultRankingsMin,
+		}
+		if expected, actual := want, qp; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("decode invalid", func(t *testing.T) {
+		for _, query := range []string{"metric=bad", "min_establishments=0", "limit=-1"} {
+			var (
+				qp     RankingsQueryParams
+				u, err = url.Parse("http://example.com?" + query)
+			)
+			if err != nil {
+				t.Error(err)
+			}
+			if err := qp.DecodeFrom(u, queryOptional); err == nil {
+				t.Errorf("%s: expected error", query)
+			}
+		}
+	})
+}
+
+func TestEstablishmentsListQueryParams(t *testing.T) {
+	t.Parallel()
+
+	t.Run("decode", func(t *testing.T) {
+		var (
+			qp     EstablishmentsListQueryParams
+			c      = encodeCursor(service.Establishment{ID: 1, Name: "Bobs burgers"})
+			u, err = url.Parse(fmt.Sprintf("http://example.com?local_id=1&rating=5&name=bobs&limit=10&cursor=%s", c))
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := qp.DecodeFrom(u, queryRequired); err != nil {
+			t.Error(err)
+		}
+
+		want := EstablishmentsListQueryParams{
+			LocalID: "1",
+			Rating:  "5",
+			Name:    "bobs",
+			Cursor:  &cursor{Name: "Bobs burgers", ID: 1},
+			Limit:   10,
+		}
+		if expected, actual := want, qp; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("decode default limit", func(t *testing.T) {
+		var (
+			qp     EstablishmentsListQueryParams
+			u, err = url.Parse("http://example.com?local_id=1")
+		)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := qp.DecodeFrom(u, queryRequired); err != nil {
+			t.Error(err)
+		}
+		if expected, actual := defaultListLimit, qp.Limit; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("decode invalid", func(t *testing.T) {
+		for _, query := range []string{
+			"",
+			"local_id=1&limit=0",
+			"local_id=1&limit=501",
+			"local_id=1&limit=abc",
+			"local_id=1&cursor=!!!",
+			"local_id=1&sort=name",
+			"local_id=1&stats=true",
+		} {
+			var (
+				qp     EstablishmentsListQueryParams
+				u, err = url.Parse(fmt.Sprintf("http://example.com?%s", query))
+			)
+			if err != nil {
+				t.Error(err)
+			}
+			if err := qp.DecodeFrom(u, queryRequired); err == nil {
+				t.Errorf("%s: expected error", query)
+			}
+		}
+	})
 }
 
 // ASCII a better string implementation for quick checking urls.
@@ -0,0 +1,403 @@
+package query
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// RankingMetric defines the metric that the authorities are ranked by.
+type RankingMetric string
+
+// These are the metrics that the authorities can be ranked by. The metrics are
+// only calculated from the establishments that have a star rating, so exempt
+// establishments or those awaiting inspection don't count for or against an
+// authority.
+const (
+	// RankFiveStar ranks by the percentage of 5-Star establishments, highest
+	// first.
+	RankFiveStar RankingMetric = "five_star"
+	// RankTwoStarOrBelow ranks by the percentage of establishments with a
+	// rating of 2-Star or below, lowest first.
+	RankTwoStarOrBelow RankingMetric = "two_star_or_below"
+	// RankMeanScore ranks by the mean star rating, highest first.
+	RankMeanScore RankingMetric = "mean_score"
+)
+
+func (m RankingMetric) valid() bool {
+	switch m {
+	case RankFiveStar, RankTwoStarOrBelow, RankMeanScore:
+		return true
+	}
+	return false
+}
+
+// starRatings are the FHRS rating names, indexed by the number of stars.
+var starRatings = []string{"0-Star", "1-Star", "2-Star", "3-Star", "4-Star", "5-Star"}
+
+// authorityRatings is the count of the ratings for a single authority.
+type authorityRatings struct {
+	Authority service.Authority
+	Scheme    Scheme
+	Counts    map[string]int
+	Schemes   map[Scheme]int
+	Total     int
+}
+
+func newAuthorityRatings(authority service.Authority, counter *ratingsCounter) authorityRatings {
+	counts := make(map[string]int, len(counter.values))
+	for k, v := range counter.values {
+		counts[k] = v
+	}
+	schemes := make(map[Scheme]int, len(counter.schemes))
+	for k, v := range counter.schemes {
+		schemes[k] = v
+	}
+	return authorityRatings{
+		Authority: authority,
+		Scheme:    counter.Scheme(),
+		Counts:    counts,
+		Schemes:   schemes,
+		Total:     counter.total,
+	}
+}
+
+// counter returns a ratingsCounter with the counts of the authority, so that
+// it can be merged with the counts of other authorities.
+func (r authorityRatings) counter() *ratingsCounter {
+	counter := newRatingsCounter()
+	for k, v := range r.Counts {
+		counter.values[k] = v
+	}
+	for k, v := range r.Schemes {
+		counter.schemes[k] = v
+	}
+	counter.total = r.Total
+	return counter
+}
+
+// fraction returns the metric of the authority as a fraction of the number of
+// establishments with a star rating, which is also returned.
+func (r authorityRatings) fraction(metric RankingMetric) (numerator, rated int) {
+	for stars, name := range starRatings {
+		count := r.Counts[name]
+		rated += count
+
+		switch metric {
+		case RankFiveStar:
+			if stars == 5 {
+				numerator += count
+			}
+		case RankTwoStarOrBelow:
+			if stars <= 2 {
+				numerator += count
+			}
+		case RankMeanScore:
+			numerator += stars * count
+		}
+	}
+	return
+}
+
+// Ranking is the position of an authority with in the rankings.
+type Ranking struct {
+	Rank      int
+	Authority service.Authority
+	Value     float64
+	Total     int
+	Rated     int
+
+	numerator int
+}
+
+// rankAuthorities ranks the authorities by the metric, best first. Only
+// authorities using the FHRS (star ratings) are ranked and only if they have
+// at least min establishments with a star rating. Authorities with the same
+// value share the same rank (i.e. 1, 2, 2, 4) and are ordered by the number of
+// rated establishments, then by name and finally by local id, so the order is
+// always the same.
+func rankAuthorities(ratings []authorityRatings, metric RankingMetric, min int) []Ranking {
+	if min < 1 {
+		min = 1
+	}
+
+	res := make([]Ranking, 0, len(ratings))
+	for _, v := range ratings {
+		if v.Scheme != SchemeFHRS {
+			continue
+		}
+		numerator, rated := v.fraction(metric)
+		if rated < min {
+			continue
+		}
+
+		value := float64(numerator) / float64(rated)
+		if metric != RankMeanScore {
+			value *= 100
+		}
+		res = append(res, Ranking{
+			Authority: v.Authority,
+			Value:     value,
+			Total:     v.Total,
+			Rated:     rated,
+			numerator: numerator,
+		})
+	}
+
+	// compare the fractions with integer maths, so that equal values are
+	// always equal. Returns less than zero if a is better than b.
+	compare := func(a, b Ranking) int {
+		x, y := a.numerator*b.Rated, b.numerator*a.Rated
+		if metric == RankTwoStarOrBelow {
+			return x - y
+		}
+		return y - x
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if c := compare(a, b); c != 0 {
+			return c < 0
+		}
+		if a.Rated != b.Rated {
+			return a.Rated > b.Rated
+		}
+		if a.Authority.Name != b.Authority.Name {
+			return a.Authority.Name < b.Authority.Name
+		}
+		return a.Authority.LocalID < b.Authority.LocalID
+	})
+
+	for k := range res {
+		if k > 0 && compare(res[k-1], res[k]) == 0 {
+			res[k].Rank = res[k-1].Rank
+			continue
+		}
+		res[k].Rank = k + 1
+	}
+	return res
+}
+
+// rankingsSnapshotBackoff is how long to wait before retrying a failed
+// refresh (or the authorities that failed during a refresh), which is doubled
+// for every retry up to the interval of the snapshot.
+const rankingsSnapshotBackoff = 30 * time.Second
+
+// RankingsSnapshot holds the ratings of every authority, so that the rankings
+// can be served with out requesting the establishments of every authority for
+// each request. The snapshot is taken in the background, see Run.
+type RankingsSnapshot struct {
+	service     service.Service
+	concurrency int
+	backoff     time.Duration
+	logger      log.Logger
+
+	mutex   sync.RWMutex
+	ratings []authorityRatings
+	failed  []service.Authority
+	taken   time.Time
+}
+
+// NewRankingsSnapshot creates a RankingsSnapshot, which requests the
+// establishments from the service with concurrency requests at a time. The
+// snapshot is empty until it's been refreshed.
+func NewRankingsSnapshot(service service.Service, concurrency int, logger log.Logger) *RankingsSnapshot {
+	return &RankingsSnapshot{
+		service:     service,
+		concurrency: concurrency,
+		backoff:     rankingsSnapshotBackoff,
+		logger:      logger,
+	}
+}
+
+// Run refreshes the snapshot straight away and then every interval, until the
+// context is done. A failed refresh, or the authorities that failed during a
+// refresh, are retried with a backoff rather than waiting for the next
+// interval, so that one failure doesn't leave the rankings unavailable (or
+// missing authorities) until then.
+func (s *RankingsSnapshot) Run(ctx context.Context, interval time.Duration) {
+	var (
+		refreshed time.Time
+		backoff   = s.backoff
+	)
+	for {
+		failed := false
+		if refreshed.IsZero() || time.Since(refreshed) >= interval {
+			begin := time.Now()
+			if err := s.Refresh(ctx); err != nil {
+				level.Warn(s.logger).Log("state", "snapshot", "err", err)
+				failed = true
+			} else {
+				refreshed = begin
+			}
+		} else {
+			s.retry(ctx)
+		}
+
+		wait := interval - time.Since(refreshed)
+		if failed || s.incomplete() {
+			if failed || backoff < wait {
+				wait = backoff
+			}
+			if backoff *= 2; backoff > interval {
+				backoff = interval
+			}
+		} else {
+			backoff = s.backoff
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Refresh takes a new snapshot of the ratings of every authority. Failing to
+// request an authority doesn't stop the snapshot, instead the authority is
+// left out until it's retried (see Run) or the next refresh. If every
+// authority fails, then the previous snapshot is kept and an error is
+// returned.
+func (s *RankingsSnapshot) Refresh(ctx context.Context) error {
+	begin := time.Now()
+
+	authorities, err := s.service.Authorities(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error requesting authorities")
+	}
+
+	ratings, failed, err := s.count(ctx, authorities)
+	if err != nil {
+		return err
+	}
+	if len(authorities) > 0 && len(failed) == len(authorities) {
+		return errors.Errorf("failed to snapshot all %d authorities", len(failed))
+	}
+
+	s.mutex.Lock()
+	s.ratings = ratings
+	s.failed = failed
+	s.taken = time.Now()
+	s.mutex.Unlock()
+
+	level.Info(s.logger).Log("state", "snapshot", "authorities", len(authorities), "failed", len(failed), "duration", time.Since(begin).String())
+	return nil
+}
+
+// retry requests the authorities that failed during the last refresh again,
+// adding the ones that succeed to the snapshot.
+func (s *RankingsSnapshot) retry(ctx context.Context) {
+	s.mutex.RLock()
+	authorities := s.failed
+	s.mutex.RUnlock()
+
+	if len(authorities) == 0 {
+		return
+	}
+
+	ratings, failed, err := s.count(ctx, authorities)
+	if err != nil {
+		level.Warn(s.logger).Log("state", "retry", "err", err)
+		return
+	}
+
+	s.mutex.Lock()
+	res := make([]authorityRatings, 0, len(s.ratings)+len(ratings))
+	s.ratings = append(append(res, s.ratings...), ratings...)
+	s.failed = failed
+	s.mutex.Unlock()
+
+	level.Info(s.logger).Log("state", "retry", "authorities", len(authorities), "failed", len(failed))
+}
+
+// count requests the ratings of the authorities, returning the ratings of the
+// ones that succeeded and the authorities that failed.
+func (s *RankingsSnapshot) count(ctx context.Context, authorities []service.Authority) ([]authorityRatings, []service.Authority, error) {
+	localIDs := make([]string, len(authorities))
+	for k, v := range authorities {
+		localIDs[k] = strconv.Itoa(v.LocalID)
+	}
+
+	ratings := make([]*authorityRatings, len(authorities))
+	if err := forEachAuthority(ctx, localIDs, s.concurrency, func(ctx context.Context, k int, localID string) error {
+		counter, err := countAuthority(ctx, s.service, localID, EstablishmentsFilters{})
+		if err != nil {
+			level.Warn(s.logger).Log("state", "snapshot", "local_id", localID, "err", err)
+			return nil
+		}
+		r := newAuthorityRatings(authorities[k], counter)
+		ratings[k] = &r
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		res    = make([]authorityRatings, 0, len(ratings))
+		failed []service.Authority
+	)
+	for k, v := range ratings {
+		if v != nil {
+			res = append(res, *v)
+		} else {
+			failed = append(failed, authorities[k])
+		}
+	}
+	return res, failed, nil
+}
+
+// incomplete returns true if some authorities failed during the last refresh
+// and haven't been retried successfully since.
+func (s *RankingsSnapshot) incomplete() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.failed) > 0
+}
+
+// snapshot returns the ratings of the snapshot and when it was taken, or false
+// if the snapshot hasn't been taken yet.
+func (s *RankingsSnapshot) snapshot() ([]authorityRatings, time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.taken.IsZero() {
+		return nil, time.Time{}, false
+	}
+	return s.ratings, s.taken, true
+}
+
+// liveAuthorityRatings requests the ratings of every authority from the
+// service, which is used when there isn't a snapshot.
+func liveAuthorityRatings(ctx context.Context, s service.Service, concurrency int) ([]authorityRatings, error) {
+	authorities, err := s.Authorities(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error requesting authorities")
+	}
+
+	localIDs := make([]string, len(authorities))
+	for k, v := range authorities {
+		localIDs[k] = strconv.Itoa(v.LocalID)
+	}
+
+	counters, err := countAuthorities(ctx, s, localIDs, EstablishmentsFilters{}, concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]authorityRatings, len(authorities))
+	for k, v := range authorities {
+		res[k] = newAuthorityRatings(v, counters[k])
+	}
+	return res, nil
+}
@@ -0,0 +1,282 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+	"github.com/SimonRichardson/foodhygiene/pkg/service/mock_service"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+)
+
+func TestRankAuthorities(t *testing.T) {
+	t.Parallel()
+
+	ratings := []authorityRatings{
+		authorityRatings{
+			Authority: service.Authority{Name: "York", LocalID: 1},
+			Scheme:    SchemeFHRS,
+			Counts:    map[string]int{"5-Star": 2, "1-Star": 2, "Exempt": 6},
+			Total:     10,
+		},
+		authorityRatings{
+			Authority: service.Authority{Name: "Leeds", LocalID: 2},
+			Scheme:    SchemeFHRS,
+			Counts:    map[string]int{"5-Star": 3, "3-Star": 1},
+			Total:     4,
+		},
+		authorityRatings{
+			Authority: service.Authority{Name: "Bath", LocalID: 3},
+			Scheme:    SchemeFHRS,
+			Counts:    map[string]int{"5-Star": 1, "2-Star": 1},
+			Total:     2,
+		},
+		authorityRatings{
+			Authority: service.Authority{Name: "Hull", LocalID: 4},
+			Scheme:    SchemeFHRS,
+			Counts:    map[string]int{"5-Star": 1},
+			Total:     1,
+		},
+		authorityRatings{
+			Authority: service.Authority{Name: "Glasgow", LocalID: 5},
+			Scheme:    SchemeFHIS,
+			Counts:    map[string]int{"Pass": 10},
+			Total:     10,
+		},
+	}
+	type ranked struct {
+		Rank    int
+		LocalID int
+		Value   float64
+	}
+	rank := func(metric RankingMetric, min int) []ranked {
+		var res []ranked
+		for _, v := range rankAuthorities(ratings, metric, min) {
+			res = append(res, ranked{v.Rank, v.Authority.LocalID, v.Value})
+		}
+		return res
+	}
+
+	t.Run("five star", func(t *testing.T) {
+		// York and Bath tie, so York is first as it has more rated
+		// establishments.
+		want := []ranked{{1, 4, 100}, {2, 2, 75}, {3, 1, 50}, {3, 3, 50}}
+		if expected, actual := want, rank(RankFiveStar, 1); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("two star or below", func(t *testing.T) {
+		want := []ranked{{1, 2, 0}, {1, 4, 0}, {3, 1, 50}, {3, 3, 50}}
+		if expected, actual := want, rank(RankTwoStarOrBelow, 1); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("mean score", func(t *testing.T) {
+		want := []ranked{{1, 4, 5}, {2, 2, 4.5}, {3, 3, 3.5}, {4, 1, 3}}
+		if expected, actual := want, rank(RankMeanScore, 1); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("min establishments", func(t *testing.T) {
+		want := []ranked{{1, 2, 75}, {2, 1, 50}}
+		if expected, actual := want, rank(RankFiveStar, 4); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestRankingsSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("refresh", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock     = mock_service.NewMockService(ctrl)
+			snapshot = NewRankingsSnapshot(mock, 2, log.NewNopLogger())
+		)
+
+		if _, _, ok := snapshot.snapshot(); ok {
+			t.Errorf("expected no snapshot")
+		}
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{
+				service.Authority{Name: "York", LocalID: 1},
+				service.Authority{Name: "Leeds", LocalID: 2},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{
+				service.Establishment{Rating: "5"},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "2").
+			Return(nil, errors.New("something went wrong"))
+
+		// A failed authority is left out, rather than failing the snapshot.
+		if err := snapshot.Refresh(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		ratings, taken, ok := snapshot.snapshot()
+		if expected, actual := true, ok && !taken.IsZero(); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, len(ratings); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, ratings[0].Authority.LocalID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("refresh failed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock     = mock_service.NewMockService(ctrl)
+			snapshot = NewRankingsSnapshot(mock, 2, log.NewNopLogger())
+		)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{
+				service.Authority{Name: "York", LocalID: 1},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return(nil, errors.New("something went wrong"))
+
+		if err := snapshot.Refresh(context.Background()); err == nil {
+			t.Errorf("expected error")
+		}
+		if _, _, ok := snapshot.snapshot(); ok {
+			t.Errorf("expected no snapshot")
+		}
+	})
+
+	t.Run("run retries refresh", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock     = mock_service.NewMockService(ctrl)
+			snapshot = NewRankingsSnapshot(mock, 2, log.NewNopLogger())
+		)
+		snapshot.backoff = time.Millisecond
+
+		gomock.InOrder(
+			mock.EXPECT().
+				Authorities(gomock.Any()).
+				Return(nil, errors.New("something went wrong")),
+			mock.EXPECT().
+				Authorities(gomock.Any()).
+				Return([]service.Authority{
+					service.Authority{Name: "York", LocalID: 1},
+				}, nil),
+		)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{
+				service.Establishment{Rating: "5"},
+			}, nil)
+
+		// The interval is far longer than the test, so the snapshot can only
+		// be ready if the failed refresh was retried.
+		stop := runSnapshot(snapshot, time.Hour)
+		defer stop()
+
+		if !waitFor(func() bool {
+			_, _, ok := snapshot.snapshot()
+			return ok
+		}) {
+			t.Fatalf("expected snapshot")
+		}
+	})
+
+	t.Run("run retries failed authorities", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock     = mock_service.NewMockService(ctrl)
+			snapshot = NewRankingsSnapshot(mock, 2, log.NewNopLogger())
+		)
+		snapshot.backoff = time.Millisecond
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{
+				service.Authority{Name: "York", LocalID: 1},
+				service.Authority{Name: "Leeds", LocalID: 2},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{
+				service.Establishment{Rating: "5"},
+			}, nil)
+		gomock.InOrder(
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "2").
+				Return(nil, errors.New("something went wrong")),
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "2").
+				Return([]service.Establishment{
+					service.Establishment{Rating: "4"},
+				}, nil),
+		)
+
+		stop := runSnapshot(snapshot, time.Hour)
+		defer stop()
+
+		if !waitFor(func() bool {
+			ratings, _, _ := snapshot.snapshot()
+			return len(ratings) == 2
+		}) {
+			t.Fatalf("expected every authority in the snapshot")
+		}
+		if expected, actual := false, snapshot.incomplete(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+// runSnapshot runs the snapshot in the background, returning a func that
+// stops it and waits for it to return.
+func runSnapshot(snapshot *RankingsSnapshot, interval time.Duration) func() {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		snapshot.Run(ctx, interval)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// waitFor polls fn until it returns true, or gives up after a second.
+func waitFor(fn func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if fn() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return fn()
+}
@@ -1,9 +1,7 @@
 package query
 
 import (
-	"fmt"
 	"sort"
-	"strings"
 
 	"github.com/SimonRichardson/foodhygiene/pkg/service"
 )
@@ -13,48 +11,218 @@ import (
 type Rating struct {
 	Name   string
 	Rating float64
+	// Count and Total are the number of establishments with the rating and the
+	// number of establishments overall, from which the Rating is calculated.
+	Count int
+	Total int
+	// Rounded is the Rating rounded to 2 decimal places, so that the rounded
+	// ratings of all the names always sum to exactly 100.
+	Rounded float64
+}
+
+// SortOrder defines the order in which the ratings are returned.
+type SortOrder string
+
+// These are the sort orders of the ratings.
+const (
+	// SortCanonical orders the ratings by the canonical order of the scheme
+	// i.e. "0-Star" through to "5-Star", followed by "Exempt" etc.
+	SortCanonical SortOrder = "canonical"
+	// SortName orders the ratings by name.
+	SortName SortOrder = "name"
+	// SortPercentage orders the ratings by the highest percentage first.
+	SortPercentage SortOrder = "percentage"
+)
+
+func (o SortOrder) valid() bool {
+	switch o {
+	case SortCanonical, SortName, SortPercentage:
+		return true
+	}
+	return false
 }
 
 func calculateRatings(establishments []service.Establishment) []Rating {
+	counter := newRatingsCounter()
+	for _, v := range establishments {
+		counter.Add(v)
+	}
+	return counter.Ratings()
+}
+
+// ratingsCounter accumulates the ratings of establishments one at a time, so
+// that the ratings can be calculated incrementally as the establishments are
+// streamed from the service.
+type ratingsCounter struct {
 	// So ratings is actually quite loose, you can have a lot of various values
-	// for the key, which makes things a bit more complicated.
+	// for the key, which makes things a bit more complicated. The values are
+	// keyed by the name with in the scheme of the establishment, so that the
+	// different spellings are counted together.
+	total   int
+	values  map[string]int
+	schemes map[Scheme]int
+}
+
+func newRatingsCounter() *ratingsCounter {
+	return &ratingsCounter{
+		values:  map[string]int{},
+		schemes: map[Scheme]int{},
+	}
+}
+
+// Add increments the values found by the rating of the establishment.
+func (c *ratingsCounter) Add(establishment service.Establishment) {
+	scheme := schemeOf(establishment)
+	c.values[scheme.ratingName(establishment.Rating)]++
+	if scheme != SchemeUnknown {
+		c.schemes[scheme]++
+	}
+	c.total++
+}
+
+// Scheme returns the scheme used by the most establishments, as an authority
+// should only use the one scheme.
+func (c *ratingsCounter) Scheme() Scheme {
 	var (
-		total  int
-		values = map[string]int{}
+		res Scheme
+		max int
 	)
-
-	// Go through and increment all the values found by ratings.
-	for _, v := range establishments {
-		values[v.Rating]++
-		total++
+	for k, v := range c.schemes {
+		if v > max || (v == max && k < res) {
+			res, max = k, v
+		}
 	}
+	return res
+}
 
-	// Now convert them to percentages
+// Ratings returns the accumulated ratings as percentages, in the canonical
+// order of the scheme.
+func (c *ratingsCounter) Ratings() []Rating {
 	var (
 		i       int
-		ratings = make([]Rating, len(values))
+		ratings = make([]Rating, len(c.values))
 	)
-	for k, v := range values {
+	for k, v := range c.values {
 		ratings[i] = Rating{
-			Name:   ratingName(k),
-			Rating: (float64(v) / float64(total)) * 100,
+			Name:   k,
+			Rating: (float64(v) / float64(c.total)) * 100,
+			Count:  v,
+			Total:  c.total,
 		}
 		i++
 	}
+	roundRatings(ratings)
 
 	// Now let's make sure we sort them into some decent order
-	sort.Slice(ratings, func(i, j int) bool { return ratings[i].Name < ratings[j].Name })
+	sortRatings(ratings, c.Scheme(), SortCanonical)
 
 	return ratings
 }
 
+// Merge adds the accumulated values of the other counter to the counter.
+func (c *ratingsCounter) Merge(other *ratingsCounter) {
+	for k, v := range other.values {
+		c.values[k] += v
+	}
+	for k, v := range other.schemes {
+		c.schemes[k] += v
+	}
+	c.total += other.total
+}
+
+// Aligned returns the accumulated ratings for the names, in the same order as
+// the names, so that the ratings of different counters line up with each
+// other. Names that the counter hasn't seen have a count of zero.
+func (c *ratingsCounter) Aligned(names []string) []Rating {
+	ratings := make([]Rating, len(names))
+	for k, v := range names {
+		ratings[k] = Rating{
+			Name:  v,
+			Count: c.values[v],
+			Total: c.total,
+		}
+		if c.total > 0 {
+			ratings[k].Rating = (float64(ratings[k].Count) / float64(c.total)) * 100
+		}
+	}
+	// There's nothing to round if there are no establishments.
+	if c.total > 0 {
+		roundRatings(ratings)
+	}
+	return ratings
+}
+
+// ratingsScale is the scale of the rounded ratings, which are rounded to
+// hundredths of a percent.
+const ratingsScale = 100 * 100
+
+// roundRatings sets the Rounded value of the ratings using the largest
+// remainder method; every rating is rounded down and the hundredths that are
+// left over are handed out to the ratings that lost the most when rounding
+// down. This guarantees that the rounded ratings sum to exactly 100.
+func roundRatings(ratings []Rating) {
+	if len(ratings) == 0 {
+		return
+	}
+
+	var (
+		total      = ratings[0].Total
+		floors     = make([]int, len(ratings))
+		remainders = make([]int, len(ratings))
+		indexes    = make([]int, len(ratings))
+		left       = ratingsScale
+	)
+	for k, v := range ratings {
+		// Use integer maths, so there are no floating point errors.
+		scaled := v.Count * ratingsScale
+		floors[k], remainders[k] = scaled/total, scaled%total
+		left -= floors[k]
+		indexes[k] = k
+	}
+
+	// Ties are broken by name, so the rounding doesn't depend on the order.
+	sort.Slice(indexes, func(i, j int) bool {
+		a, b := indexes[i], indexes[j]
+		if remainders[a] != remainders[b] {
+			return remainders[a] > remainders[b]
+		}
+		return ratings[a].Name < ratings[b].Name
+	})
+	for _, k := range indexes[:left] {
+		floors[k]++
+	}
+
+	for k := range ratings {
+		ratings[k].Rounded = float64(floors[k]) / 100
+	}
+}
+
+// sortRatings sorts the ratings in place by the order. Ties are broken by the
+// canonical order of the scheme and then by name, so the order is stable.
+func sortRatings(ratings []Rating, scheme Scheme, order SortOrder) {
+	canonical := func(a, b Rating) bool {
+		if x, y := scheme.rank(a.Name), scheme.rank(b.Name); x != y {
+			return x < y
+		}
+		return a.Name < b.Name
+	}
+
+	sort.Slice(ratings, func(i, j int) bool {
+		a, b := ratings[i], ratings[j]
+		switch order {
+		case SortName:
+			return a.Name < b.Name
+		case SortPercentage:
+			if a.Rating != b.Rating {
+				return a.Rating > b.Rating
+			}
+		}
+		return canonical(a, b)
+	})
+}
+
 // ratingNames converts values into correctly expected rating values
 // i.e. "3" == "3-Star" and "pass" == "Pass"
 func ratingName(name string) string {
-	switch name {
-	case "1", "2", "3", "4", "5":
-		return fmt.Sprintf("%s-Star", name)
-	default:
-		return strings.Title(name)
-	}
+	return SchemeUnknown.ratingName(name)
 }
@@ -2,6 +2,7 @@ package query
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
 	"strings"
@@ -31,8 +32,11 @@ func TestCalculateRatings(t *testing.T) {
 		}
 		want := []Rating{
 			Rating{
-				Name:   "3-Star",
-				Rating: 100.0,
+				Name:    "3-Star",
+				Rating:  100.0,
+				Count:   1,
+				Total:   1,
+				Rounded: 100.0,
 			},
 		}
 		got := calculateRatings(estab)
@@ -57,8 +61,11 @@ func TestCalculateRatings(t *testing.T) {
 		}
 		want := []Rating{
 			Rating{
-				Name:   "3-Star",
-				Rating: 100.0,
+				Name:    "3-Star",
+				Rating:  100.0,
+				Count:   2,
+				Total:   2,
+				Rounded: 100.0,
 			},
 		}
 		got := calculateRatings(estab)
@@ -83,12 +90,18 @@ func TestCalculateRatings(t *testing.T) {
 		}
 		want := []Rating{
 			Rating{
-				Name:   "3-Star",
-				Rating: 50.0,
+				Name:    "3-Star",
+				Rating:  50.0,
+				Count:   1,
+				Total:   2,
+				Rounded: 50.0,
 			},
 			Rating{
-				Name:   "4-Star",
-				Rating: 50.0,
+				Name:    "4-Star",
+				Rating:  50.0,
+				Count:   1,
+				Total:   2,
+				Rounded: 50.0,
 			},
 		}
 		got := calculateRatings(estab)
@@ -127,13 +140,31 @@ func TestCalculateRatings(t *testing.T) {
 				}
 				return ((offset / numRatings) / amountf) * 100
 			}
+			count := func(index int) int {
+				if index < amount%len(ratings) {
+					return amount/len(ratings) + 1
+				}
+				return amount / len(ratings)
+			}
 			for k := range ratings {
 				want[k] = Rating{
 					Name:   strings.Title(ratings[k]),
 					Rating: rating(k),
+					Count:  count(k),
+					Total:  amount,
 				}
 			}
 
+			// The rounded ratings should always sum to exactly 100.00%
+			var rounded int
+			for k, v := range got {
+				rounded += int(math.Round(v.Rounded * 100))
+				got[k].Rounded = 0
+			}
+			if expected, actual := 100*100, rounded; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+
 			if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
 				t.Errorf("expected: %v, actual: %v", expected, actual)
 			}
@@ -147,6 +178,118 @@ func TestCalculateRatings(t *testing.T) {
 	})
 }
 
+func TestRoundRatings(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		counts []int
+		want   []float64
+	}{
+		{[]int{1, 1, 1}, []float64{33.34, 33.33, 33.33}},
+		{[]int{2, 1}, []float64{66.67, 33.33}},
+		{[]int{1, 1, 1, 1, 1, 1, 1}, []float64{14.29, 14.29, 14.29, 14.29, 14.28, 14.28, 14.28}},
+		{[]int{1, 0}, []float64{100, 0}},
+	} {
+		var (
+			total   int
+			ratings = make([]Rating, len(test.counts))
+		)
+		for _, v := range test.counts {
+			total += v
+		}
+		for k, v := range test.counts {
+			ratings[k] = Rating{
+				Name:  fmt.Sprintf("%d", k),
+				Count: v,
+				Total: total,
+			}
+		}
+
+		roundRatings(ratings)
+
+		got := make([]float64, len(ratings))
+		for k, v := range ratings {
+			got[k] = v.Rounded
+		}
+		if expected, actual := test.want, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%v: expected: %v, actual: %v", test.counts, expected, actual)
+		}
+	}
+}
+
+func TestRatingsCounterAligned(t *testing.T) {
+	t.Parallel()
+
+	var (
+		a = newRatingsCounter()
+		b = newRatingsCounter()
+	)
+	a.Add(service.Establishment{Rating: "5"})
+	a.Add(service.Establishment{Rating: "4"})
+	b.Add(service.Establishment{Rating: "5"})
+
+	pooled := newRatingsCounter()
+	pooled.Merge(a)
+	pooled.Merge(b)
+
+	if expected, actual := 3, pooled.total; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	names := []string{"4-Star", "5-Star", "Exempt"}
+	want := []Rating{
+		Rating{Name: "4-Star", Rating: 0, Count: 0, Total: 1, Rounded: 0},
+		Rating{Name: "5-Star", Rating: 100, Count: 1, Total: 1, Rounded: 100},
+		Rating{Name: "Exempt", Rating: 0, Count: 0, Total: 1, Rounded: 0},
+	}
+	if expected, actual := want, b.Aligned(names); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+
+	// A counter with out any establishments is still aligned, but is all zero.
+	for _, v := range newRatingsCounter().Aligned(names) {
+		if v.Count != 0 || v.Rating != 0 || v.Rounded != 0 {
+			t.Errorf("expected zero, actual: %v", v)
+		}
+	}
+}
+
+func TestSortRatings(t *testing.T) {
+	t.Parallel()
+
+	ratings := func() []Rating {
+		return []Rating{
+			Rating{Name: "Awaiting Inspection", Rating: 10},
+			Rating{Name: "5-Star", Rating: 40},
+			Rating{Name: "Alpha", Rating: 10},
+			Rating{Name: "0-Star", Rating: 10},
+			Rating{Name: "Exempt", Rating: 30},
+		}
+	}
+	names := func(ratings []Rating) []string {
+		res := make([]string, len(ratings))
+		for k, v := range ratings {
+			res[k] = v.Name
+		}
+		return res
+	}
+
+	for _, test := range []struct {
+		order SortOrder
+		want  []string
+	}{
+		{SortCanonical, []string{"0-Star", "5-Star", "Exempt", "Awaiting Inspection", "Alpha"}},
+		{SortName, []string{"0-Star", "5-Star", "Alpha", "Awaiting Inspection", "Exempt"}},
+		{SortPercentage, []string{"5-Star", "Exempt", "0-Star", "Awaiting Inspection", "Alpha"}},
+	} {
+		got := ratings()
+		sortRatings(got, SchemeFHRS, test.order)
+		if expected, actual := test.want, names(got); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%s: expected: %v, actual: %v", test.order, expected, actual)
+		}
+	}
+}
+
 func TestRatingName(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,116 @@
+package query
+
+import (
+	"context"
+	"strings"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+// OutputReference is a normalized version of the reference data from the
+// service (regions, countries, business types, scheme types and ratings), so
+// that the UI can treat them all the same when filtering.
+type OutputReference struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Key          string `json:"key,omitempty"`
+	Code         string `json:"code,omitempty"`
+	SchemeTypeID int    `json:"scheme_type_id,omitempty"`
+}
+
+func (a *API) regions(ctx context.Context) ([]OutputReference, error) {
+	regions, err := a.service.Regions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]OutputReference, len(regions))
+	for k, v := range regions {
+		res[k] = OutputReference{
+			ID:   v.ID,
+			Name: v.Name,
+			Code: v.Code,
+		}
+	}
+	return res, nil
+}
+
+func (a *API) countries(ctx context.Context) ([]OutputReference, error) {
+	countries, err := a.service.Countries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]OutputReference, len(countries))
+	for k, v := range countries {
+		res[k] = OutputReference{
+			ID:   v.ID,
+			Name: v.Name,
+			Code: v.Code,
+		}
+	}
+	return res, nil
+}
+
+func (a *API) businessTypes(ctx context.Context) ([]OutputReference, error) {
+	businessTypes, err := a.service.BusinessTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]OutputReference, len(businessTypes))
+	for k, v := range businessTypes {
+		res[k] = OutputReference{
+			ID:   v.ID,
+			Name: v.Name,
+		}
+	}
+	return res, nil
+}
+
+func (a *API) schemeTypes(ctx context.Context) ([]OutputReference, error) {
+	schemeTypes, err := a.service.SchemeTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]OutputReference, len(schemeTypes))
+	for k, v := range schemeTypes {
+		res[k] = OutputReference{
+			ID:   v.ID,
+			Name: v.Name,
+			Key:  v.Key,
+		}
+	}
+	return res, nil
+}
+
+// ratings returns the ratings named the same as the ratings breakdown, so the
+// UI can match them up.
+func (a *API) ratings(ctx context.Context) ([]OutputReference, error) {
+	ratings, err := a.service.Ratings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]OutputReference, len(ratings))
+	for k, v := range ratings {
+		res[k] = OutputReference{
+			ID:           v.ID,
+			Name:         ratingName(v.Name),
+			Key:          v.Key,
+			SchemeTypeID: v.SchemeTypeID,
+		}
+	}
+	return res, nil
+}
+
+// filterAuthorities returns the authorities with in the region of the params,
+// if there is one.
+func filterAuthorities(authorities []service.Authority, p AuthoritiesQueryParams) []service.Authority {
+	if p.Region == "" {
+		return authorities
+	}
+	res := make([]service.Authority, 0)
+	for _, v := range authorities {
+		if strings.EqualFold(v.Region, p.Region) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -3,8 +3,12 @@ package query
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/SimonRichardson/foodhygiene/pkg/search"
 	"github.com/SimonRichardson/foodhygiene/pkg/service"
 )
 
@@ -24,6 +28,7 @@ func (r *AuthoritiesResult) EncodeTo(w http.ResponseWriter) {
 		records[k] = OutputAuthority{
 			Name:    v.Name,
 			LocalID: v.LocalID,
+			Region:  v.Region,
 		}
 	}
 
@@ -35,9 +40,12 @@ func (r *AuthoritiesResult) EncodeTo(w http.ResponseWriter) {
 // EstablishmentsResult outputs the ratings for a given authority establishments
 // from the food hygiene service
 type EstablishmentsResult struct {
-	Params   EstablishmentsQueryParams
-	Duration string
-	Records  []Rating
+	Params    EstablishmentsQueryParams
+	Duration  string
+	Freshness service.Freshness
+	Scheme    Scheme
+	Records   []Rating
+	Stats     Stats
 }
 
 // EncodeTo encodes the EstablishmentsResult to the HTTP response writer.
@@ -46,15 +54,319 @@ func (r *EstablishmentsResult) EncodeTo(w http.ResponseWriter) {
 	w.Header().Set(httpHeaderDuration, r.Duration)
 	w.Header().Set(httpHeaderLocalID, r.Params.LocalID)
 
-	records := make([]OutputRating, len(r.Records))
+	if r.Scheme != SchemeUnknown {
+		w.Header().Set(httpHeaderScheme, string(r.Scheme))
+	}
+
+	// Only tell the client about the freshness if it was recorded.
+	if status := r.Freshness.Status; status != "" {
+		w.Header().Set(httpHeaderCacheStatus, string(status))
+		w.Header().Set(httpHeaderAge, strconv.Itoa(int(r.Freshness.Age.Seconds())))
+	}
+
+	// The ratings are returned on their own, unless the stats were asked for,
+	// so that existing clients (i.e. the UI) still get a bare array. Only the
+	// envelope carries the scheme, otherwise the header is the only place it's
+	// returned.
+	var output interface{} = outputRatings(r.Records)
+	if r.Params.Stats {
+		output = OutputEstablishments{
+			Scheme:  r.Scheme,
+			Ratings: outputRatings(r.Records),
+			Stats:   outputStats(r.Stats),
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(output); err != nil {
+		panic(err)
+	}
+}
+
+// ListResult outputs a page of the establishments for a given authority from
+// the food hygiene service
+type ListResult struct {
+	Params    EstablishmentsListQueryParams
+	Duration  string
+	Freshness service.Freshness
+	Records   []service.Establishment
+	Next      string
+}
+
+// EncodeTo encodes the ListResult to the HTTP response writer.
+// Note: if the records can't be encoded then panic, so we don't fail silently.
+func (r *ListResult) EncodeTo(w http.ResponseWriter) {
+	w.Header().Set(httpHeaderDuration, r.Duration)
+	w.Header().Set(httpHeaderLocalID, r.Params.LocalID)
+
+	// Only tell the client about the freshness if it was recorded.
+	if status := r.Freshness.Status; status != "" {
+		w.Header().Set(httpHeaderCacheStatus, string(status))
+		w.Header().Set(httpHeaderAge, strconv.Itoa(int(r.Freshness.Age.Seconds())))
+	}
+
+	records := make([]OutputEstablishment, len(r.Records))
+	for k, v := range r.Records {
+		records[k] = outputEstablishment(v)
+	}
+
+	if err := json.NewEncoder(w).Encode(OutputList{
+		Establishments: records,
+		Next:           r.Next,
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// EstablishmentResult outputs a single establishment from the food hygiene
+// service
+type EstablishmentResult struct {
+	Params    EstablishmentQueryParams
+	Duration  string
+	Freshness service.Freshness
+	Record    service.Establishment
+}
+
+// EncodeTo encodes the EstablishmentResult to the HTTP response writer.
+// Note: if the record can't be encoded then panic, so we don't fail silently.
+func (r *EstablishmentResult) EncodeTo(w http.ResponseWriter) {
+	w.Header().Set(httpHeaderDuration, r.Duration)
+
+	// Only tell the client about the freshness if it was recorded.
+	if status := r.Freshness.Status; status != "" {
+		w.Header().Set(httpHeaderCacheStatus, string(status))
+		w.Header().Set(httpHeaderAge, strconv.Itoa(int(r.Freshness.Age.Seconds())))
+	}
+
+	record := OutputEstablishmentDetail{
+		OutputEstablishment: outputEstablishment(r.Record),
+		Scores: OutputScores{
+			Hygiene:                r.Record.Scores.Hygiene,
+			Structural:             r.Record.Scores.Structural,
+			ConfidenceInManagement: r.Record.Scores.ConfidenceInManagement,
+		},
+	}
+
+	if err := json.NewEncoder(w).Encode(record); err != nil {
+		panic(err)
+	}
+}
+
+// SearchResult outputs the establishments that matched a search across every
+// indexed authority
+type SearchResult struct {
+	Params      SearchQueryParams
+	Duration    string
+	Authorities int
+	Records     []search.Result
+}
+
+// EncodeTo encodes the SearchResult to the HTTP response writer.
+// Note: if the records can't be encoded then panic, so we don't fail silently.
+func (r *SearchResult) EncodeTo(w http.ResponseWriter) {
+	w.Header().Set(httpHeaderDuration, r.Duration)
+
+	records := make([]OutputSearchEstablishment, len(r.Records))
 	for k, v := range r.Records {
-		records[k] = OutputRating{
-			Name:   v.Name,
-			Rating: fmt.Sprintf("%.2f%s", v.Rating, "%"),
+		records[k] = outputSearchEstablishment(v)
+	}
+
+	if err := json.NewEncoder(w).Encode(OutputSearch{
+		Establishments: records,
+		Authorities:    r.Authorities,
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// NearbyResult outputs the establishments near to a location across every
+// indexed authority, along with the ratings of them
+type NearbyResult struct {
+	Params      NearbyQueryParams
+	Duration    string
+	Authorities int
+	Scheme      Scheme
+	Records     []search.Result
+	Ratings     []Rating
+}
+
+// EncodeTo encodes the NearbyResult to the HTTP response writer.
+// Note: if the records can't be encoded then panic, so we don't fail silently.
+func (r *NearbyResult) EncodeTo(w http.ResponseWriter) {
+	w.Header().Set(httpHeaderDuration, r.Duration)
+
+	if r.Scheme != SchemeUnknown {
+		w.Header().Set(httpHeaderScheme, string(r.Scheme))
+	}
+
+	records := make([]OutputNearbyEstablishment, len(r.Records))
+	for k, v := range r.Records {
+		records[k] = OutputNearbyEstablishment{
+			OutputSearchEstablishment: outputSearchEstablishment(v),
+			Distance:                  math.Round(v.Distance),
 		}
 	}
 
-	if err := json.NewEncoder(w).Encode(records); err != nil {
+	if err := json.NewEncoder(w).Encode(OutputNearby{
+		Establishments: records,
+		Ratings:        outputRatings(r.Ratings),
+		Authorities:    r.Authorities,
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// outputRatings converts the ratings into the output ratings.
+func outputRatings(ratings []Rating) []OutputRating {
+	res := make([]OutputRating, len(ratings))
+	for k, v := range ratings {
+		res[k] = OutputRating{
+			Name:       v.Name,
+			Rating:     fmt.Sprintf("%.2f%s", v.Rounded, "%"),
+			Count:      v.Count,
+			Total:      v.Total,
+			Percentage: v.Rating,
+			Rounded:    v.Rounded,
+		}
+	}
+	return res
+}
+
+// CompareResult outputs the ratings for several authorities aligned to each
+// other, along with the pooled ratings
+type CompareResult struct {
+	Params   CompareQueryParams
+	Duration string
+	Records  Comparison
+}
+
+// EncodeTo encodes the CompareResult to the HTTP response writer.
+// Note: if the records can't be encoded then panic, so we don't fail silently.
+func (r *CompareResult) EncodeTo(w http.ResponseWriter) {
+	w.Header().Set(httpHeaderDuration, r.Duration)
+
+	output := func(c ComparisonRatings) OutputComparison {
+		return OutputComparison{
+			LocalID: c.LocalID,
+			Scheme:  c.Scheme,
+			Total:   c.Total,
+			Ratings: outputRatings(c.Ratings),
+		}
+	}
+
+	authorities := make([]OutputComparison, len(r.Records.Authorities))
+	for k, v := range r.Records.Authorities {
+		authorities[k] = output(v)
+	}
+
+	if err := json.NewEncoder(w).Encode(OutputCompare{
+		Authorities: authorities,
+		Pooled:      output(r.Records.Pooled),
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// AggregateResult outputs the ratings for the groups of authorities
+type AggregateResult struct {
+	Params   AggregateQueryParams
+	Duration string
+	Snapshot time.Time
+	Records  []AggregateGroup
+}
+
+// EncodeTo encodes the AggregateResult to the HTTP response writer.
+// Note: if the records can't be encoded then panic, so we don't fail silently.
+func (r *AggregateResult) EncodeTo(w http.ResponseWriter) {
+	w.Header().Set(httpHeaderDuration, r.Duration)
+
+	groups := make([]OutputAggregateGroup, len(r.Records))
+	for k, v := range r.Records {
+		groups[k] = OutputAggregateGroup{
+			Name:               v.Name,
+			Authorities:        v.Authorities,
+			EstablishmentCount: v.EstablishmentCount,
+			Scheme:             v.Scheme,
+			Total:              v.Total,
+			Ratings:            outputRatings(v.Ratings),
+		}
+	}
+
+	output := OutputAggregate{
+		Level:  r.Params.Level,
+		Groups: groups,
+	}
+
+	// Tell the client how old the snapshot is, if it was served from one.
+	if !r.Snapshot.IsZero() {
+		w.Header().Set(httpHeaderAge, strconv.Itoa(int(time.Since(r.Snapshot).Seconds())))
+		output.Snapshot = r.Snapshot.UTC().Format(time.RFC3339)
+	}
+
+	if err := json.NewEncoder(w).Encode(output); err != nil {
+		panic(err)
+	}
+}
+
+// RankingsResult outputs the authorities ranked by a metric
+type RankingsResult struct {
+	Params   RankingsQueryParams
+	Duration string
+	Snapshot time.Time
+	Records  []Ranking
+}
+
+// EncodeTo encodes the RankingsResult to the HTTP response writer.
+// Note: if the records can't be encoded then panic, so we don't fail silently.
+func (r *RankingsResult) EncodeTo(w http.ResponseWriter) {
+	w.Header().Set(httpHeaderDuration, r.Duration)
+
+	output := OutputRankings{
+		Metric:   r.Params.Metric,
+		Rankings: make([]OutputRanking, len(r.Records)),
+	}
+
+	// Tell the client how old the snapshot is, if it was served from one.
+	if !r.Snapshot.IsZero() {
+		w.Header().Set(httpHeaderAge, strconv.Itoa(int(time.Since(r.Snapshot).Seconds())))
+		output.Snapshot = r.Snapshot.UTC().Format(time.RFC3339)
+	}
+
+	for k, v := range r.Records {
+		output.Rankings[k] = OutputRanking{
+			Rank:    v.Rank,
+			LocalID: v.Authority.LocalID,
+			Name:    v.Authority.Name,
+			Region:  v.Authority.Region,
+			Value:   v.Value,
+			Total:   v.Total,
+			Rated:   v.Rated,
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(output); err != nil {
+		panic(err)
+	}
+}
+
+// ReferencesResult outputs the reference data from the food hygiene service
+type ReferencesResult struct {
+	Duration  string
+	Freshness service.Freshness
+	Records   []OutputReference
+}
+
+// EncodeTo encodes the ReferencesResult to the HTTP response writer.
+// Note: if the records can't be encoded then panic, so we don't fail silently.
+func (r *ReferencesResult) EncodeTo(w http.ResponseWriter) {
+	w.Header().Set(httpHeaderDuration, r.Duration)
+
+	// Only tell the client about the freshness if it was recorded.
+	if status := r.Freshness.Status; status != "" {
+		w.Header().Set(httpHeaderCacheStatus, string(status))
+		w.Header().Set(httpHeaderAge, strconv.Itoa(int(r.Freshness.Age.Seconds())))
+	}
+
+	if err := json.NewEncoder(w).Encode(r.Records); err != nil {
 		panic(err)
 	}
 }
@@ -68,13 +380,253 @@ func (r *EstablishmentsResult) EncodeTo(w http.ResponseWriter) {
 type OutputAuthority struct {
 	Name    string `json:"name"`
 	LocalID int    `json:"local_id"`
+	Region  string `json:"region,omitempty"`
+}
+
+// OutputCompare is the output of the ratings of several authorities, the
+// ratings of every authority have the same names in the same order as the
+// pooled ratings.
+type OutputCompare struct {
+	Authorities []OutputComparison `json:"authorities"`
+	Pooled      OutputComparison   `json:"pooled"`
+}
+
+// OutputComparison is the ratings of a single authority or of the pool.
+type OutputComparison struct {
+	LocalID string         `json:"local_id,omitempty"`
+	Scheme  Scheme         `json:"scheme,omitempty"`
+	Total   int            `json:"total"`
+	Ratings []OutputRating `json:"ratings"`
+}
+
+// OutputAggregate is the output of the ratings aggregated by the level, the
+// snapshot is the time the ratings were counted, if they were served from the
+// rankings snapshot.
+type OutputAggregate struct {
+	Level    AggregateLevel         `json:"level"`
+	Snapshot string                 `json:"snapshot,omitempty"`
+	Groups   []OutputAggregateGroup `json:"groups"`
+}
+
+// OutputAggregateGroup is the pooled ratings of a group of authorities. The
+// establishment count is the number reported by the service for the
+// authorities, whilst the total is the number that were rated.
+type OutputAggregateGroup struct {
+	Name               string         `json:"name"`
+	Authorities        int            `json:"authorities"`
+	EstablishmentCount int            `json:"establishment_count"`
+	Scheme             Scheme         `json:"scheme,omitempty"`
+	Total              int            `json:"total"`
+	Ratings            []OutputRating `json:"ratings"`
+}
+
+// OutputRankings is the output of the authorities ranked by the metric, the
+// snapshot is the time the rankings were calculated, if they were served from
+// a snapshot.
+type OutputRankings struct {
+	Metric   RankingMetric   `json:"metric"`
+	Snapshot string          `json:"snapshot,omitempty"`
+	Rankings []OutputRanking `json:"rankings"`
+}
+
+// OutputRanking is the position of an authority in the rankings. The value is
+// a percentage, or the mean star rating, of the rated establishments.
+type OutputRanking struct {
+	Rank    int     `json:"rank"`
+	LocalID int     `json:"local_id"`
+	Name    string  `json:"name"`
+	Region  string  `json:"region,omitempty"`
+	Value   float64 `json:"value"`
+	Total   int     `json:"total"`
+	Rated   int     `json:"rated"`
+}
+
+// OutputEstablishments is the ratings output along with the scheme and the
+// stats of the authority.
+type OutputEstablishments struct {
+	Scheme  Scheme         `json:"scheme,omitempty"`
+	Ratings []OutputRating `json:"ratings"`
+	Stats   OutputStats    `json:"stats"`
+}
+
+// OutputStats is the descriptive statistics of the ratings. The numeric values
+// are calculated from the star ratings only, so they're null if there aren't
+// any (i.e. authorities using the FHIS).
+type OutputStats struct {
+	Total        int             `json:"total"`
+	Rated        int             `json:"rated"`
+	Unrated      int             `json:"unrated"`
+	RatedShare   float64         `json:"rated_share"`
+	UnratedShare float64         `json:"unrated_share"`
+	Scored       int             `json:"scored"`
+	Mean         *float64        `json:"mean"`
+	Median       *float64        `json:"median"`
+	StdDev       *float64        `json:"std_dev"`
+	FiveStar     *OutputInterval `json:"five_star"`
+}
+
+// OutputInterval is a percentage with the bounds of its confidence interval.
+type OutputInterval struct {
+	Share      float64 `json:"share"`
+	Lower      float64 `json:"lower"`
+	Upper      float64 `json:"upper"`
+	Confidence float64 `json:"confidence"`
+}
+
+func outputStats(stats Stats) OutputStats {
+	res := OutputStats{
+		Total:   stats.Total,
+		Rated:   stats.Rated,
+		Unrated: stats.Unrated,
+		Scored:  stats.Scored,
+	}
+	if stats.Total > 0 {
+		res.RatedShare = float64(stats.Rated) / float64(stats.Total) * 100
+		res.UnratedShare = float64(stats.Unrated) / float64(stats.Total) * 100
+	}
+	if stats.Scored > 0 {
+		mean, median, stdDev := stats.Mean, stats.Median, stats.StdDev
+		res.Mean, res.Median, res.StdDev = &mean, &median, &stdDev
+		res.FiveStar = &OutputInterval{
+			Share:      stats.FiveStar.Value,
+			Lower:      stats.FiveStar.Lower,
+			Upper:      stats.FiveStar.Upper,
+			Confidence: stats.FiveStar.Confidence,
+		}
+	}
+	return res
 }
 
 // OutputRating is the ratings output for all the accumulated ratings for the
-// authority
+// authority. The rating is the rounded percentage formatted for display, whilst
+// the count and total allow the exact percentage to be recovered.
 type OutputRating struct {
-	Name   string `json:"name"`
-	Rating string `json:"rating"`
+	Name       string  `json:"name"`
+	Rating     string  `json:"rating"`
+	Count      int     `json:"count"`
+	Total      int     `json:"total"`
+	Percentage float64 `json:"percentage"`
+	Rounded    float64 `json:"rounded"`
+}
+
+// OutputEstablishment is a normalized version of service.Establishment, with
+// the rating named with in the scheme of the establishment.
+type OutputEstablishment struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name"`
+	BusinessType string   `json:"business_type"`
+	Address      []string `json:"address"`
+	PostCode     string   `json:"post_code"`
+	Rating       string   `json:"rating"`
+	RatingDate   string   `json:"rating_date,omitempty"`
+	Scheme       Scheme   `json:"scheme,omitempty"`
+	Latitude     *float64 `json:"latitude,omitempty"`
+	Longitude    *float64 `json:"longitude,omitempty"`
+}
+
+func outputEstablishment(e service.Establishment) OutputEstablishment {
+	scheme := schemeOf(e)
+	res := OutputEstablishment{
+		ID:           e.ID,
+		Name:         e.Name,
+		BusinessType: e.BusinessType,
+		Address:      e.Address(),
+		PostCode:     e.PostCode,
+		Rating:       scheme.ratingName(e.Rating),
+		Scheme:       scheme,
+	}
+	if e.Geocode.Valid {
+		lat, lng := e.Geocode.Latitude, e.Geocode.Longitude
+		res.Latitude, res.Longitude = &lat, &lng
+	}
+	if res.Address == nil {
+		res.Address = make([]string, 0)
+	}
+	if !e.RatingDate.IsZero() {
+		res.RatingDate = e.RatingDate.Format("2006-01-02")
+	}
+	return res
+}
+
+// OutputEstablishmentDetail is the OutputEstablishment along with the scores
+// of the last inspection.
+type OutputEstablishmentDetail struct {
+	OutputEstablishment
+	Scores OutputScores `json:"scores"`
+}
+
+// OutputScores are the scores of the last inspection, the scores are null if
+// the establishment hasn't been scored.
+// Note: lower scores are better.
+type OutputScores struct {
+	Hygiene                *int `json:"hygiene"`
+	Structural             *int `json:"structural"`
+	ConfidenceInManagement *int `json:"confidence_in_management"`
+}
+
+// OutputList is a page of establishments, the next cursor is empty if there
+// are no more establishments.
+type OutputList struct {
+	Establishments []OutputEstablishment `json:"establishments"`
+	Next           string                `json:"next,omitempty"`
+}
+
+// OutputSearchEstablishment is an establishment that matched a search, along
+// with the authority it belongs to. The index only keeps some of the fields of
+// every establishment, so only those are output (rather than the whole of the
+// OutputEstablishment with the rest of the fields empty).
+type OutputSearchEstablishment struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	PostCode  string   `json:"post_code"`
+	Rating    string   `json:"rating"`
+	Scheme    Scheme   `json:"scheme,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	LocalID   string   `json:"local_id"`
+}
+
+func outputSearchEstablishment(r search.Result) OutputSearchEstablishment {
+	var (
+		e      = r.Establishment
+		scheme = schemeOf(e)
+	)
+	res := OutputSearchEstablishment{
+		ID:       e.ID,
+		Name:     e.Name,
+		PostCode: e.PostCode,
+		Rating:   scheme.ratingName(e.Rating),
+		Scheme:   scheme,
+		LocalID:  r.LocalID,
+	}
+	if e.Geocode.Valid {
+		lat, lng := e.Geocode.Latitude, e.Geocode.Longitude
+		res.Latitude, res.Longitude = &lat, &lng
+	}
+	return res
+}
+
+// OutputSearch is the establishments that matched a search. Only authorities
+// that have been indexed are searched, so the number of them is included.
+type OutputSearch struct {
+	Establishments []OutputSearchEstablishment `json:"establishments"`
+	Authorities    int                         `json:"authorities"`
+}
+
+// OutputNearbyEstablishment is the OutputSearchEstablishment along with the
+// distance (in metres) from the location.
+type OutputNearbyEstablishment struct {
+	OutputSearchEstablishment
+	Distance float64 `json:"distance"`
+}
+
+// OutputNearby is the establishments near to a location, nearest first, along
+// with the ratings of every establishment with in the radius. Only authorities
+// that have been indexed are searched, so the number of them is included.
+type OutputNearby struct {
+	Establishments []OutputNearbyEstablishment `json:"establishments"`
+	Ratings        []OutputRating              `json:"ratings"`
+	Authorities    int                         `json:"authorities"`
 }
 
 type queryBehavior int
@@ -0,0 +1,143 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+// Scheme defines the rating scheme used to rate an establishment. England,
+// Wales and Northern Ireland use the Food Hygiene Rating Scheme (FHRS), which
+// uses star ratings, whilst Scotland uses the Food Hygiene Information Scheme
+// (FHIS), which uses pass or improvement required.
+type Scheme string
+
+// These are the rating schemes that are recognised.
+const (
+	SchemeUnknown Scheme = ""
+	SchemeFHRS    Scheme = "FHRS"
+	SchemeFHIS    Scheme = "FHIS"
+)
+
+// vocabularies defines the names of the rating values for each of the schemes.
+// The keys are the rating values normalized (see normalizeRating), so that the
+// various spellings from the service all end up with the same name.
+var vocabularies = map[Scheme]map[string]string{
+	SchemeFHRS: {
+		"0":                   "0-Star",
+		"1":                   "1-Star",
+		"2":                   "2-Star",
+		"3":                   "3-Star",
+		"4":                   "4-Star",
+		"5":                   "5-Star",
+		"exempt":              "Exempt",
+		"awaitinginspection":  "Awaiting Inspection",
+		"awaitingpublication": "Awaiting Publication",
+	},
+	SchemeFHIS: {
+		"pass":                "Pass",
+		"passandeatsafe":      "Pass and Eat Safe",
+		"improvementrequired": "Improvement Required",
+		"exempt":              "Exempt",
+		"exemptpremises":      "Exempt",
+		"awaitinginspection":  "Awaiting Inspection",
+		"awaitingpublication": "Awaiting Publication",
+	},
+}
+
+// orders defines the canonical order of the rating names for each of the
+// schemes, from the ratings to the categories that aren't ratings at all.
+var orders = map[Scheme][]string{
+	SchemeFHRS: {
+		"0-Star",
+		"1-Star",
+		"2-Star",
+		"3-Star",
+		"4-Star",
+		"5-Star",
+		"Exempt",
+		"Awaiting Inspection",
+		"Awaiting Publication",
+	},
+	SchemeFHIS: {
+		"Pass",
+		"Pass and Eat Safe",
+		"Improvement Required",
+		"Exempt",
+		"Awaiting Inspection",
+		"Awaiting Publication",
+	},
+}
+
+// schemeOf returns the scheme of the establishment. If the service didn't tell
+// us the scheme, then we infer it from the rating value.
+func schemeOf(establishment service.Establishment) Scheme {
+	switch Scheme(strings.ToUpper(establishment.Scheme)) {
+	case SchemeFHRS:
+		return SchemeFHRS
+	case SchemeFHIS:
+		return SchemeFHIS
+	}
+	return inferScheme(establishment.Rating)
+}
+
+// inferScheme returns the scheme that the rating value belongs to, if the value
+// is shared between schemes (i.e. "Exempt") then the scheme is unknown.
+func inferScheme(value string) Scheme {
+	var (
+		key     = normalizeRating(value)
+		_, fhrs = vocabularies[SchemeFHRS][key]
+		_, fhis = vocabularies[SchemeFHIS][key]
+	)
+	switch {
+	case fhrs && !fhis:
+		return SchemeFHRS
+	case fhis && !fhrs:
+		return SchemeFHIS
+	}
+	return SchemeUnknown
+}
+
+// ratingName returns the name of the rating value with in the scheme. If the
+// value isn't part of the scheme vocabulary, then it's title cased.
+func (s Scheme) ratingName(value string) string {
+	key := normalizeRating(value)
+	if name, ok := vocabularies[s][key]; ok {
+		return name
+	}
+	// Fallback to any scheme that knows about the value.
+	for _, scheme := range []Scheme{SchemeFHRS, SchemeFHIS} {
+		if name, ok := vocabularies[scheme][key]; ok {
+			return name
+		}
+	}
+	return strings.Title(value)
+}
+
+// normalizeRating lowercases the rating value and removes anything that isn't
+// a letter or digit i.e. "Awaiting Inspection" == "AwaitingInspection"
+func normalizeRating(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, value)
+}
+
+// rank returns the position of the rating name with in the canonical order of
+// the scheme. Names from other schemes are ranked after the scheme's own names
+// and any name that no scheme knows about is ranked last.
+func (s Scheme) rank(name string) int {
+	var offset int
+	for _, scheme := range []Scheme{s, SchemeFHRS, SchemeFHIS} {
+		for k, v := range orders[scheme] {
+			if v == name {
+				return offset + k
+			}
+		}
+		offset += len(orders[scheme])
+	}
+	return offset
+}
@@ -0,0 +1,90 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+func TestSchemeOf(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		establishment service.Establishment
+		scheme        Scheme
+	}{
+		{service.Establishment{Scheme: "FHRS", Rating: "Exempt"}, SchemeFHRS},
+		{service.Establishment{Scheme: "fhis", Rating: "Exempt"}, SchemeFHIS},
+		{service.Establishment{Rating: "4"}, SchemeFHRS},
+		{service.Establishment{Rating: "Pass and Eat Safe"}, SchemeFHIS},
+		{service.Establishment{Rating: "improvement required"}, SchemeFHIS},
+		{service.Establishment{Rating: "Exempt"}, SchemeUnknown},
+		{service.Establishment{Rating: "alpha"}, SchemeUnknown},
+	} {
+		if expected, actual := test.scheme, schemeOf(test.establishment); expected != actual {
+			t.Errorf("%v: expected: %q, actual: %q", test.establishment.Rating, expected, actual)
+		}
+	}
+}
+
+func TestSchemeRatingName(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		scheme Scheme
+		value  string
+		name   string
+	}{
+		{SchemeFHRS, "0", "0-Star"},
+		{SchemeFHRS, "AwaitingInspection", "Awaiting Inspection"},
+		{SchemeFHIS, "Pass", "Pass"},
+		{SchemeFHIS, "PASS AND EAT SAFE", "Pass and Eat Safe"},
+		{SchemeFHIS, "Improvement Required", "Improvement Required"},
+		{SchemeFHIS, "Exempt Premises", "Exempt"},
+		{SchemeFHIS, "5", "5-Star"},
+		{SchemeUnknown, "awaiting-publication", "Awaiting Publication"},
+		{SchemeUnknown, "alpha", "Alpha"},
+	} {
+		if expected, actual := test.name, test.scheme.ratingName(test.value); expected != actual {
+			t.Errorf("%v: expected: %q, actual: %q", test.value, expected, actual)
+		}
+	}
+}
+
+func TestCalculateRatingsFHIS(t *testing.T) {
+	t.Parallel()
+
+	counter := newRatingsCounter()
+	for _, rating := range []string{
+		"Pass",
+		"pass",
+		"Improvement Required",
+		"ImprovementRequired",
+	} {
+		counter.Add(service.Establishment{Rating: rating})
+	}
+
+	want := []Rating{
+		Rating{
+			Name:    "Pass",
+			Rating:  50.0,
+			Count:   2,
+			Total:   4,
+			Rounded: 50.0,
+		},
+		Rating{
+			Name:    "Improvement Required",
+			Rating:  50.0,
+			Count:   2,
+			Total:   4,
+			Rounded: 50.0,
+		},
+	}
+	if expected, actual := want, counter.Ratings(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := SchemeFHIS, counter.Scheme(); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
@@ -0,0 +1,126 @@
+package query
+
+import (
+	"math"
+)
+
+// These define the confidence of the Wilson score interval and the z score of
+// that confidence.
+const (
+	wilsonConfidence = 0.95
+	wilsonZ          = 1.959964
+)
+
+// ratedNames are the names of the ratings that are an actual rating of an
+// inspection, rather than a category i.e. "Exempt" or "Awaiting Inspection".
+var ratedNames = map[string]struct{}{
+	"0-Star":               {},
+	"1-Star":               {},
+	"2-Star":               {},
+	"3-Star":               {},
+	"4-Star":               {},
+	"5-Star":               {},
+	"Pass":                 {},
+	"Pass and Eat Safe":    {},
+	"Improvement Required": {},
+}
+
+// Stats defines the descriptive statistics of the ratings of an authority.
+// The numeric statistics are calculated from the star ratings only, so they're
+// not valid (Scored is zero) for authorities using the FHIS.
+type Stats struct {
+	Total   int
+	Rated   int
+	Unrated int
+	// Scored is the number of establishments with a star rating, from which
+	// the mean, median, standard deviation and 5-Star share are calculated.
+	Scored   int
+	Mean     float64
+	Median   float64
+	StdDev   float64
+	FiveStar Interval
+}
+
+// Interval is a proportion, as a percentage, along with the lower and upper
+// bounds of its confidence interval.
+type Interval struct {
+	Value      float64
+	Lower      float64
+	Upper      float64
+	Confidence float64
+}
+
+// Stats returns the descriptive statistics of the accumulated ratings.
+func (c *ratingsCounter) Stats() Stats {
+	res := Stats{
+		Total: c.total,
+	}
+	for k, v := range c.values {
+		if _, ok := ratedNames[k]; ok {
+			res.Rated += v
+		}
+	}
+	res.Unrated = res.Total - res.Rated
+
+	counts := make([]int, len(starRatings))
+	for stars, name := range starRatings {
+		counts[stars] = c.values[name]
+		res.Scored += counts[stars]
+	}
+	if res.Scored == 0 {
+		return res
+	}
+
+	var sum int
+	for stars, count := range counts {
+		sum += stars * count
+	}
+	res.Mean = float64(sum) / float64(res.Scored)
+
+	var squares float64
+	for stars, count := range counts {
+		d := float64(stars) - res.Mean
+		squares += d * d * float64(count)
+	}
+	res.StdDev = math.Sqrt(squares / float64(res.Scored))
+
+	// The median is the middle star rating, or the mean of the two middle star
+	// ratings if there are an even number of them.
+	res.Median = float64(nthStars(counts, (res.Scored-1)/2)+nthStars(counts, res.Scored/2)) / 2
+
+	res.FiveStar = wilson(counts[5], res.Scored)
+
+	return res
+}
+
+// nthStars returns the star rating of the nth (zero based) establishment, when
+// ordered by the star rating.
+func nthStars(counts []int, n int) int {
+	for stars, count := range counts {
+		if n < count {
+			return stars
+		}
+		n -= count
+	}
+	return len(counts) - 1
+}
+
+// wilson returns the proportion of successes out of n, along with the Wilson
+// score interval. Unlike the normal approximation, the interval stays with in
+// 0 to 100% and is still meaningful for small authorities.
+func wilson(successes, n int) Interval {
+	var (
+		p      = float64(successes) / float64(n)
+		z2     = wilsonZ * wilsonZ
+		nf     = float64(n)
+		denom  = 1 + z2/nf
+		centre = p + z2/(2*nf)
+		margin = wilsonZ * math.Sqrt(p*(1-p)/nf+z2/(4*nf*nf))
+	)
+	return Interval{
+		Value:      p * 100,
+		Lower:      math.Max(0, (centre-margin)/denom) * 100,
+		Upper:      math.Min(1, (centre+margin)/denom) * 100,
+		Confidence: wilsonConfidence,
+	}
+}
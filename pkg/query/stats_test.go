@@ -0,0 +1,89 @@
+package query
+
+import (
+	"math"
+	"testing"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+func TestRatingsCounterStats(t *testing.T) {
+	t.Parallel()
+
+	approx := func(a, b float64) bool {
+		return math.Abs(a-b) < 1e-6
+	}
+
+	t.Run("stars", func(t *testing.T) {
+		counter := newRatingsCounter()
+		for _, rating := range []string{"1", "3", "5", "5", "Exempt", "AwaitingInspection"} {
+			counter.Add(service.Establishment{Rating: rating})
+		}
+
+		stats := counter.Stats()
+		if expected, actual := [4]int{6, 4, 2, 4}, [4]int{stats.Total, stats.Rated, stats.Unrated, stats.Scored}; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 3.5, stats.Mean; !approx(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 4.0, stats.Median; !approx(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := math.Sqrt(2.75), stats.StdDev; !approx(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 50.0, stats.FiveStar.Value; !approx(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("median odd", func(t *testing.T) {
+		counter := newRatingsCounter()
+		for _, rating := range []string{"0", "2", "2", "4", "5"} {
+			counter.Add(service.Establishment{Rating: rating})
+		}
+		if expected, actual := 2.0, counter.Stats().Median; !approx(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("fhis", func(t *testing.T) {
+		counter := newRatingsCounter()
+		for _, rating := range []string{"Pass", "Improvement Required", "Exempt"} {
+			counter.Add(service.Establishment{Rating: rating})
+		}
+
+		stats := counter.Stats()
+		if expected, actual := (Stats{Total: 3, Rated: 2, Unrated: 1}), stats; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if expected, actual := (Stats{}), newRatingsCounter().Stats(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestWilson(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		successes, n int
+		lower, upper float64
+	}{
+		{0, 30, 0, 11.351339},
+		{15, 30, 33.154126, 66.845874},
+		{1, 1, 20.654931, 100},
+	} {
+		interval := wilson(test.successes, test.n)
+		if math.Abs(interval.Lower-test.lower) > 1e-5 || math.Abs(interval.Upper-test.upper) > 1e-5 {
+			t.Errorf("%d/%d: expected: %v-%v, actual: %v-%v", test.successes, test.n, test.lower, test.upper, interval.Lower, interval.Upper)
+		}
+		if interval.Lower > interval.Value || interval.Value > interval.Upper {
+			t.Errorf("%d/%d: expected %v with in %v-%v", test.successes, test.n, interval.Value, interval.Lower, interval.Upper)
+		}
+	}
+}
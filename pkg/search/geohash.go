@@ -0,0 +1,121 @@
+package search
+
+import "math"
+
+// geohashBase32 is the alphabet of a geohash.
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohashPrecision is the precision every establishment is indexed at, which is
+// roughly a 5m cell.
+const geohashPrecision = 9
+
+// earthRadius is the mean radius of the earth in metres.
+const earthRadius = 6371008.8
+
+// geohash encodes the coordinates as a geohash of the precision. Every
+// character of the hash halves the cell 5 times, alternating between the
+// longitude and latitude, so that a hash is always a prefix of the hashes of
+// the cells with in it.
+func geohash(lat, lng float64, precision int) string {
+	var (
+		res    = make([]byte, precision)
+		latMin = -90.0
+		latMax = 90.0
+		lngMin = -180.0
+		lngMax = 180.0
+		even   = true
+	)
+	for i := 0; i < precision; i++ {
+		var index byte
+		for bit := 0; bit < 5; bit++ {
+			index <<= 1
+			if even {
+				if mid := (lngMin + lngMax) / 2; lng >= mid {
+					index |= 1
+					lngMin = mid
+				} else {
+					lngMax = mid
+				}
+			} else {
+				if mid := (latMin + latMax) / 2; lat >= mid {
+					index |= 1
+					latMin = mid
+				} else {
+					latMax = mid
+				}
+			}
+			even = !even
+		}
+		res[i] = geohashBase32[index]
+	}
+	return string(res)
+}
+
+// geohashCell returns the size in degrees of a cell of the precision.
+func geohashCell(precision int) (lat, lng float64) {
+	var (
+		bits    = precision * 5
+		lngBits = (bits + 1) / 2
+		latBits = bits / 2
+	)
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lngBits))
+}
+
+// geohashCovering returns the geohashes of the cells that cover the circle of
+// the radius (in metres) around the coordinates. The precision is chosen so
+// that a cell is at least as big as the radius, so the circle is always with
+// in the cell of the coordinates and it's neighbours.
+func geohashCovering(lat, lng, radius float64) []string {
+	var (
+		radiusLat = radius / earthRadius * 180 / math.Pi
+		radiusLng = radiusLat / math.Max(math.Cos(lat*math.Pi/180), 1e-6)
+		precision = 0
+	)
+	for p := 1; p <= geohashPrecision; p++ {
+		cellLat, cellLng := geohashCell(p)
+		if cellLat < radiusLat || cellLng < radiusLng {
+			break
+		}
+		precision = p
+	}
+	// The radius is bigger than any cell, so everything is covered.
+	if precision == 0 {
+		return []string{""}
+	}
+
+	var (
+		cellLat, cellLng = geohashCell(precision)
+		seen             = make(map[string]struct{}, 9)
+		res              = make([]string, 0, 9)
+	)
+	for y := -1; y <= 1; y++ {
+		for x := -1; x <= 1; x++ {
+			nlat := lat + float64(y)*cellLat
+			if nlat < -90 || nlat > 90 {
+				continue
+			}
+			// Wrap around the anti-meridian.
+			nlng := math.Mod(lng+float64(x)*cellLng+540, 360) - 180
+			hash := geohash(nlat, nlng, precision)
+			if _, ok := seen[hash]; !ok {
+				seen[hash] = struct{}{}
+				res = append(res, hash)
+			}
+		}
+	}
+	return res
+}
+
+// distance returns the great circle distance in metres between the two
+// coordinates, using the haversine formula.
+func distance(lat1, lng1, lat2, lng2 float64) float64 {
+	var (
+		phi1 = lat1 * math.Pi / 180
+		phi2 = lat2 * math.Pi / 180
+		dphi = (lat2 - lat1) * math.Pi / 180
+		dlam = (lng2 - lng1) * math.Pi / 180
+		a    = math.Sin(dphi/2)*math.Sin(dphi/2) +
+			math.Cos(phi1)*math.Cos(phi2)*math.Sin(dlam/2)*math.Sin(dlam/2)
+	)
+	return 2 * earthRadius * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
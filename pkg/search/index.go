@@ -0,0 +1,366 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+// Result is a establishment that matched a search, along with the authority it
+// belongs to. The distance (in metres) is only set for spatial searches.
+// Note: the index only keeps a compact document for every establishment, so
+// only the ID, name, postcode, rating and scheme (along with the location for
+// spatial searches) of the Establishment are set.
+type Result struct {
+	LocalID       string
+	Establishment service.Establishment
+	Distance      float64
+}
+
+// document is the value that's indexed for every establishment. Only the
+// fields that are searched for or rendered in the results are kept, rather
+// than a copy of the whole establishment.
+type document struct {
+	localID  string
+	id       int
+	name     string
+	postCode string
+	rating   string
+	scheme   string
+	tokens   []string
+}
+
+func newDocument(localID string, establishment service.Establishment) document {
+	return document{
+		localID:  localID,
+		id:       establishment.ID,
+		name:     establishment.Name,
+		postCode: establishment.PostCode,
+		rating:   establishment.Rating,
+		scheme:   establishment.Scheme,
+		tokens:   documentTokens(establishment),
+	}
+}
+
+// establishment returns the Establishment of the document, with only the
+// fields that the document keeps.
+func (d document) establishment() service.Establishment {
+	return service.Establishment{
+		ID:       d.id,
+		Name:     d.name,
+		PostCode: d.postCode,
+		Rating:   d.rating,
+		Scheme:   d.scheme,
+	}
+}
+
+// Index is an in-process inverted index of establishments, which can be
+// searched by business name or postcode across every authority that has been
+// indexed. Every token of a document maps to the establishments containing
+// it, and the tokens are kept sorted, so that a query token can match every
+// token it's a prefix of. The number of documents can be bounded, in which case
+// the authorities that were indexed the longest ago are evicted first.
+type Index struct {
+	mutex       sync.Mutex
+	max         int
+	documents   map[int]document
+	authorities map[string][]int
+	order       []string
+	postings    map[string]map[int]struct{}
+	terms       []string
+	dirty       bool
+}
+
+// NewIndex creates a new empty Index, which holds up to max documents (one
+// for every establishment). A max of zero leaves the index unbounded.
+// Note: the most recently indexed authority is never evicted, even if it has
+// more establishments than max on it's own.
+func NewIndex(max int) *Index {
+	return &Index{
+		max:         max,
+		documents:   make(map[int]document),
+		authorities: make(map[string][]int),
+		postings:    make(map[string]map[int]struct{}),
+	}
+}
+
+// Add indexes the establishments of an authority, replacing anything that was
+// previously indexed for the authority.
+func (i *Index) Add(localID string, establishments []service.Establishment) {
+	batch := i.Stage(localID)
+	for _, v := range establishments {
+		batch.Add(v)
+	}
+	batch.Commit()
+}
+
+// Stage returns a Batch for the establishments of an authority, which only
+// holds the documents of the establishments until it's committed.
+func (i *Index) Stage(localID string) Batch {
+	return &indexBatch{
+		index:   i,
+		localID: localID,
+	}
+}
+
+// indexBatch stages the documents of an authority for an Index.
+type indexBatch struct {
+	index     *Index
+	localID   string
+	documents []document
+}
+
+// Add stages the document of the establishment.
+func (b *indexBatch) Add(establishment service.Establishment) {
+	b.documents = append(b.documents, newDocument(b.localID, establishment))
+}
+
+// Commit indexes the staged documents, replacing anything that was previously
+// indexed for the authority.
+func (b *indexBatch) Commit() {
+	b.index.commit(b.localID, b.documents)
+	b.documents = nil
+}
+
+func (i *Index) commit(localID string, documents []document) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.remove(localID)
+
+	ids := make([]int, 0, len(documents))
+	for _, doc := range documents {
+		// An establishment can move between authorities, so remove it from
+		// where it was previously found.
+		if prev, ok := i.documents[doc.id]; ok {
+			i.removeDocument(prev)
+		}
+
+		for _, token := range doc.tokens {
+			postings, ok := i.postings[token]
+			if !ok {
+				postings = make(map[int]struct{})
+				i.postings[token] = postings
+				i.dirty = true
+			}
+			postings[doc.id] = struct{}{}
+		}
+		i.documents[doc.id] = doc
+		ids = append(ids, doc.id)
+	}
+	i.authorities[localID] = ids
+	i.order = append(i.order, localID)
+
+	// Evict the authorities that were indexed the longest ago, until there is
+	// room for the documents.
+	for i.max > 0 && len(i.documents) > i.max && len(i.order) > 1 {
+		i.remove(i.order[0])
+	}
+}
+
+// Authorities returns the number of authorities that have been indexed.
+func (i *Index) Authorities() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return len(i.authorities)
+}
+
+// Search returns up to limit establishments that match every token of the
+// query. A query token matches any token that it's a prefix of, but the
+// results that match exactly are ranked first, followed by name and then id.
+func (i *Index) Search(query string, limit int) []Result {
+	tokens := tokenize(query)
+	if len(tokens) == 0 || limit < 1 {
+		return make([]Result, 0)
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	// The terms are only sorted when they're required, so that adding lots of
+	// authorities at once (i.e. warming) doesn't sort them every time.
+	if i.dirty {
+		i.terms = i.terms[:0]
+		for term := range i.postings {
+			i.terms = append(i.terms, term)
+		}
+		sort.Strings(i.terms)
+		i.dirty = false
+	}
+
+	// Score every establishment that matches all of the tokens, counting how
+	// many of them matched exactly.
+	var scores map[int]int
+	for _, token := range tokens {
+		matches := make(map[int]int)
+		for _, term := range i.prefixed(token) {
+			exact := 0
+			if term == token {
+				exact = 1
+			}
+			for id := range i.postings[term] {
+				if score, ok := matches[id]; !ok || exact > score {
+					matches[id] = exact
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = matches
+			continue
+		}
+		for id, score := range scores {
+			if match, ok := matches[id]; ok {
+				scores[id] = score + match
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		x, y := ids[a], ids[b]
+		if scores[x] != scores[y] {
+			return scores[x] > scores[y]
+		}
+		if nx, ny := i.documents[x].name, i.documents[y].name; nx != ny {
+			return nx < ny
+		}
+		return x < y
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	res := make([]Result, len(ids))
+	for k, id := range ids {
+		doc := i.documents[id]
+		res[k] = Result{
+			LocalID:       doc.localID,
+			Establishment: doc.establishment(),
+		}
+	}
+	return res
+}
+
+// prefixed returns all the terms that start with the prefix.
+// Note: the mutex is expected to be held by the caller.
+func (i *Index) prefixed(prefix string) []string {
+	start := sort.SearchStrings(i.terms, prefix)
+	end := start
+	for end < len(i.terms) && strings.HasPrefix(i.terms[end], prefix) {
+		end++
+	}
+	return i.terms[start:end]
+}
+
+// remove removes every document of the authority.
+// Note: the mutex is expected to be held by the caller.
+func (i *Index) remove(localID string) {
+	if _, ok := i.authorities[localID]; !ok {
+		return
+	}
+	for _, id := range i.authorities[localID] {
+		if doc, ok := i.documents[id]; ok && doc.localID == localID {
+			i.removeDocument(doc)
+		}
+	}
+	delete(i.authorities, localID)
+
+	for k, v := range i.order {
+		if v == localID {
+			i.order = append(i.order[:k], i.order[k+1:]...)
+			break
+		}
+	}
+}
+
+// removeDocument removes the document from the postings.
+// Note: the mutex is expected to be held by the caller.
+func (i *Index) removeDocument(doc document) {
+	id := doc.id
+	for _, token := range doc.tokens {
+		ids := i.postings[token]
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(i.postings, token)
+			i.dirty = true
+		}
+	}
+	delete(i.documents, id)
+}
+
+// documentTokens returns the tokens of the business name and postcode of the
+// establishment. The postcode is also indexed with out the space, so that it
+// can be searched for either way i.e. "YO1 7HH" or "YO17HH".
+func documentTokens(establishment service.Establishment) []string {
+	tokens := append(tokenize(establishment.Name), tokenize(establishment.PostCode)...)
+	if postcode := strings.Join(tokenize(establishment.PostCode), ""); postcode != "" {
+		tokens = append(tokens, postcode)
+	}
+
+	// Remove any duplicates.
+	var (
+		seen = make(map[string]struct{}, len(tokens))
+		res  = tokens[:0]
+	)
+	for _, token := range tokens {
+		if _, ok := seen[token]; !ok {
+			seen[token] = struct{}{}
+			res = append(res, token)
+		}
+	}
+	return res
+}
+
+// tokenize splits the value into case folded tokens of letters and digits.
+func tokenize(value string) []string {
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// indexed returns true if the authority is in the index.
+func (i *Index) indexed(localID string) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	_, ok := i.authorities[localID]
+	return ok
+}
+
+// resolve returns the Result of every spatial entry, along with it's distance,
+// from the documents of the index. Entries with out a document for the same
+// authority are dropped.
+func (i *Index) resolve(entries []spatialEntry, distances []float64) []Result {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	res := make([]Result, 0, len(entries))
+	for k, entry := range entries {
+		doc, ok := i.documents[entry.id]
+		if !ok || doc.localID != entry.localID {
+			continue
+		}
+		establishment := doc.establishment()
+		establishment.Geocode = service.Geocode{
+			Latitude:  entry.latitude,
+			Longitude: entry.longitude,
+			Valid:     true,
+		}
+		res = append(res, Result{
+			LocalID:       doc.localID,
+			Establishment: establishment,
+			Distance:      distances[k],
+		})
+	}
+	return res
+}
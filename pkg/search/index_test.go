@@ -0,0 +1,158 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+func TestIndexSearch(t *testing.T) {
+	t.Parallel()
+
+	index := NewIndex(0)
+	index.Add("1", []service.Establishment{
+		service.Establishment{ID: 1, Name: "Bobs Burgers", PostCode: "YO1 7HH"},
+		service.Establishment{ID: 2, Name: "Bobs Bakery", PostCode: "YO1 8AA"},
+		service.Establishment{ID: 3, Name: "Freds Pizzas", PostCode: "YO24 1AB"},
+	})
+	index.Add("2", []service.Establishment{
+		service.Establishment{ID: 4, Name: "The Bob", PostCode: "LS1 1AA"},
+		service.Establishment{ID: 5, Name: "Café Bobby's", PostCode: "LS2 2BB"},
+	})
+
+	for _, test := range []struct {
+		query string
+		want  []int
+	}{
+		{"bob", []int{4, 2, 1, 5}},
+		{"BOBS", []int{2, 1}},
+		{"bobs bur", []int{1}},
+		{"yo1", []int{2, 1}},
+		{"yo1 7hh", []int{1}},
+		{"YO17HH", []int{1}},
+		{"ls", []int{5, 4}},
+		{"café", []int{5}},
+		{"pizza yo24", []int{3}},
+		{"pizza ls1", []int{}},
+		{"", []int{}},
+		{"!!!", []int{}},
+	} {
+		var got []int
+		for _, v := range index.Search(test.query, 10) {
+			got = append(got, v.Establishment.ID)
+		}
+		if got == nil {
+			got = []int{}
+		}
+		if expected, actual := test.want, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%q: expected: %v, actual: %v", test.query, expected, actual)
+		}
+	}
+
+	if expected, actual := 2, len(index.Search("bob", 2)); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := "1", index.Search("pizza", 10)[0].LocalID; expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestIndexAdd(t *testing.T) {
+	t.Parallel()
+
+	t.Run("replaces authority", func(t *testing.T) {
+		index := NewIndex(0)
+		index.Add("1", []service.Establishment{
+			service.Establishment{ID: 1, Name: "Bobs Burgers"},
+		})
+		index.Add("1", []service.Establishment{
+			service.Establishment{ID: 2, Name: "Freds Pizzas"},
+		})
+
+		if expected, actual := 0, len(index.Search("bobs", 10)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, len(index.Search("freds", 10)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, index.Authorities(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("moves authority", func(t *testing.T) {
+		index := NewIndex(0)
+		index.Add("1", []service.Establishment{
+			service.Establishment{ID: 1, Name: "Bobs Burgers"},
+		})
+		index.Add("2", []service.Establishment{
+			service.Establishment{ID: 1, Name: "Bobs Burgers"},
+		})
+		// Re-indexing the old authority shouldn't remove it from the new one.
+		index.Add("1", []service.Establishment{})
+
+		got := index.Search("bobs", 10)
+		if expected, actual := 1, len(got); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "2", got[0].LocalID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+	t.Run("evicts oldest authority", func(t *testing.T) {
+		index := NewIndex(3)
+		index.Add("1", []service.Establishment{
+			service.Establishment{ID: 1, Name: "Bobs Burgers"},
+			service.Establishment{ID: 2, Name: "Bobs Bakery"},
+		})
+		index.Add("2", []service.Establishment{
+			service.Establishment{ID: 3, Name: "Bobs Pizzas"},
+		})
+		// Re-indexing an authority makes it the most recent.
+		index.Add("1", []service.Establishment{
+			service.Establishment{ID: 1, Name: "Bobs Burgers"},
+			service.Establishment{ID: 2, Name: "Bobs Bakery"},
+		})
+		index.Add("3", []service.Establishment{
+			service.Establishment{ID: 4, Name: "Bobs Cafe"},
+		})
+
+		var got []int
+		for _, v := range index.Search("bobs", 10) {
+			got = append(got, v.Establishment.ID)
+		}
+		if expected, actual := []int{2, 1, 4}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, index.Authorities(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("keeps compact documents", func(t *testing.T) {
+		index := NewIndex(0)
+		index.Add("1", []service.Establishment{
+			service.Establishment{
+				ID:           1,
+				Name:         "Bobs Burgers",
+				PostCode:     "YO1 7HH",
+				Rating:       "5",
+				Scheme:       "FHRS",
+				BusinessType: "Takeaway",
+				Address1:     "1 High Street",
+			},
+		})
+
+		want := service.Establishment{
+			ID:       1,
+			Name:     "Bobs Burgers",
+			PostCode: "YO1 7HH",
+			Rating:   "5",
+			Scheme:   "FHRS",
+		}
+		if expected, actual := want, index.Search("bobs", 10)[0].Establishment; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package search
+
+import (
+	"context"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+// Indexer describes an index that the establishments of an authority can be
+// added to i.e. Index and SpatialIndex.
+type Indexer interface {
+	// Stage returns a Batch for the establishments of an authority, which are
+	// only indexed once the batch is committed.
+	Stage(string) Batch
+}
+
+// Batch stages the establishments of an authority as they're requested. The
+// batch only holds the values the index keeps, rather than the establishments
+// themselves. Committing the batch replaces anything that was previously
+// indexed for the authority; a batch that's never committed is rolled back,
+// leaving the index as it was.
+type Batch interface {
+	// Add stages the establishment. Add isn't safe to call concurrently.
+	Add(service.Establishment)
+	// Commit indexes every establishment that was staged.
+	Commit()
+}
+
+// indexService wraps another service, indexing the establishments of every
+// authority that's successfully requested through it. Placed underneath the
+// cache, the indexes are built from the same results that are cached
+// (including the ones requested whilst warming).
+type indexService struct {
+	service service.Service
+	indexes []Indexer
+}
+
+// NewService returns a new service that will consume a service, but adds the
+// establishments of every authority requested to the indexes.
+func NewService(s service.Service, indexes ...Indexer) service.Service {
+	return &indexService{
+		service: s,
+		indexes: indexes,
+	}
+}
+
+// Authorities returns a series of Authorities from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *indexService) Authorities(ctx context.Context) ([]service.Authority, error) {
+	return s.service.Authorities(ctx)
+}
+
+// EstablishmentsForAuthority returns a series of Establishments from the
+// underlying API or it returns an error if it was not able to request or
+// parse the result. The Establishments service API takes a Authority
+// LocalID to select the correct set of establishments for that Authority.
+func (s *indexService) EstablishmentsForAuthority(ctx context.Context, localID string) ([]service.Establishment, error) {
+	res, err := s.service.EstablishmentsForAuthority(ctx, localID)
+	if err == nil {
+		s.add(localID, res)
+	}
+	return res, err
+}
+
+// Establishment returns a single Establishment by it's FHRSID from the
+// underlying API or it returns an error if it was not able to request or parse
+// the result.
+func (s *indexService) Establishment(ctx context.Context, id int) (service.Establishment, error) {
+	return s.service.Establishment(ctx, id)
+}
+
+// Regions returns a series of Regions from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *indexService) Regions(ctx context.Context) ([]service.Region, error) {
+	return s.service.Regions(ctx)
+}
+
+// Countries returns a series of Countries from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *indexService) Countries(ctx context.Context) ([]service.Country, error) {
+	return s.service.Countries(ctx)
+}
+
+// BusinessTypes returns a series of BusinessTypes from the underlying API or
+// it returns an error if it was not able to request or parse the result.
+func (s *indexService) BusinessTypes(ctx context.Context) ([]service.BusinessType, error) {
+	return s.service.BusinessTypes(ctx)
+}
+
+// SchemeTypes returns a series of SchemeTypes from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *indexService) SchemeTypes(ctx context.Context) ([]service.SchemeType, error) {
+	return s.service.SchemeTypes(ctx)
+}
+
+// Ratings returns a series of Ratings from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *indexService) Ratings(ctx context.Context) ([]service.Rating, error) {
+	return s.service.Ratings(ctx)
+}
+
+// StreamEstablishmentsForAuthority calls fn for every Establishment of the
+// Authority, streaming them if the underlying service supports it. Every
+// establishment is staged as it's streamed, but they're only committed to the
+// indexes if the whole stream was successful.
+func (s *indexService) StreamEstablishmentsForAuthority(ctx context.Context, localID string, fn func(service.Establishment) error) error {
+	batches := s.stage(localID)
+	if err := service.StreamEstablishmentsForAuthority(ctx, s.service, localID, func(e service.Establishment) error {
+		for _, batch := range batches {
+			batch.Add(e)
+		}
+		return fn(e)
+	}); err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		batch.Commit()
+	}
+	return nil
+}
+
+func (s *indexService) add(localID string, establishments []service.Establishment) {
+	for _, batch := range s.stage(localID) {
+		for _, v := range establishments {
+			batch.Add(v)
+		}
+		batch.Commit()
+	}
+}
+
+func (s *indexService) stage(localID string) []Batch {
+	batches := make([]Batch, len(s.indexes))
+	for k, index := range s.indexes {
+		batches[k] = index.Stage(localID)
+	}
+	return batches
+}
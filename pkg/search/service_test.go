@@ -0,0 +1,149 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+	"github.com/SimonRichardson/foodhygiene/pkg/service/mock_service"
+	"github.com/golang/mock/gomock"
+)
+
+func TestIndexService(t *testing.T) {
+	t.Parallel()
+
+	t.Run("indexes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock  = mock_service.NewMockService(ctrl)
+			index = NewIndex(0)
+			api   = NewService(mock, index)
+		)
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{
+				service.Establishment{ID: 1, Name: "Bobs Burgers"},
+			}, nil)
+
+		if _, err := api.EstablishmentsForAuthority(context.Background(), "0"); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 1, len(index.Search("bobs", 10)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock  = mock_service.NewMockService(ctrl)
+			index = NewIndex(0)
+			api   = NewService(mock, index)
+		)
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{
+				service.Establishment{ID: 1, Name: "Bobs Burgers"},
+				service.Establishment{ID: 2, Name: "Bobs Bakery"},
+			}, nil)
+
+		var n int
+		if err := service.StreamEstablishmentsForAuthority(context.Background(), api, "0", func(service.Establishment) error {
+			n++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 2, n; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, len(index.Search("bobs", 10)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock  = mock_service.NewMockService(ctrl)
+			index = NewIndex(0)
+			api   = NewService(mock, index)
+		)
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return(nil, errors.New("something went wrong"))
+
+		if _, err := api.EstablishmentsForAuthority(context.Background(), "0"); err == nil {
+			t.Errorf("expected error")
+		}
+		if expected, actual := 0, index.Authorities(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+	t.Run("stream rolled back", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			index = NewIndex(0)
+			api   = NewService(streamService{
+				Service: mock_service.NewMockService(ctrl),
+				establishments: []service.Establishment{
+					service.Establishment{ID: 2, Name: "Bobs Bakery"},
+					service.Establishment{ID: 3, Name: "Bobs Pizzas"},
+				},
+				err: errors.New("something went wrong"),
+			}, index)
+		)
+		index.Add("0", []service.Establishment{
+			service.Establishment{ID: 1, Name: "Bobs Burgers"},
+		})
+
+		var n int
+		if err := service.StreamEstablishmentsForAuthority(context.Background(), api, "0", func(service.Establishment) error {
+			n++
+			return nil
+		}); err == nil {
+			t.Errorf("expected error")
+		}
+		if expected, actual := 2, n; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The failed stream shouldn't replace what was already indexed.
+		got := index.Search("bobs", 10)
+		if expected, actual := 1, len(got); expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, got[0].Establishment.ID; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+// streamService is a service.Streamer that streams the establishments and then
+// returns the error.
+type streamService struct {
+	service.Service
+	establishments []service.Establishment
+	err            error
+}
+
+func (s streamService) StreamEstablishmentsForAuthority(ctx context.Context, localID string, fn func(service.Establishment) error) error {
+	for _, v := range s.establishments {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
@@ -0,0 +1,199 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+// spatialEntry is the value that's indexed for every located establishment.
+// Only the id and the location are kept, the rest of the establishment is
+// resolved through the text index.
+type spatialEntry struct {
+	hash      string
+	localID   string
+	id        int
+	latitude  float64
+	longitude float64
+}
+
+// SpatialIndex is an in-process spatial index of establishments, which can be
+// queried for the establishments near to some coordinates across every
+// authority that has been indexed. Every establishment is indexed by the
+// geohash of it's location and the hashes are kept sorted, so the cells near
+// to the coordinates are found with a binary search rather than a scan of
+// every establishment. Establishments with out a location aren't indexed.
+//
+// The spatial index sits along side a text index, which the establishments are
+// resolved through and which bounds the spatial index: once the text index has
+// evicted an authority, the spatial index drops it as well.
+type SpatialIndex struct {
+	mutex       sync.Mutex
+	index       *Index
+	entries     map[int]spatialEntry
+	authorities map[string][]int
+	sorted      []spatialEntry
+	dirty       bool
+}
+
+// NewSpatialIndex creates a new empty SpatialIndex, which resolves the
+// establishments through the index. Both indexes are expected to be fed the
+// same establishments i.e. via NewService.
+func NewSpatialIndex(index *Index) *SpatialIndex {
+	return &SpatialIndex{
+		index:       index,
+		entries:     make(map[int]spatialEntry),
+		authorities: make(map[string][]int),
+	}
+}
+
+// Add indexes the establishments of an authority, replacing anything that was
+// previously indexed for the authority.
+func (i *SpatialIndex) Add(localID string, establishments []service.Establishment) {
+	batch := i.Stage(localID)
+	for _, v := range establishments {
+		batch.Add(v)
+	}
+	batch.Commit()
+}
+
+// Stage returns a Batch for the establishments of an authority, which only
+// holds the locations of the establishments until it's committed.
+func (i *SpatialIndex) Stage(localID string) Batch {
+	return &spatialBatch{
+		index:   i,
+		localID: localID,
+	}
+}
+
+// spatialBatch stages the entries of an authority for a SpatialIndex.
+type spatialBatch struct {
+	index   *SpatialIndex
+	localID string
+	entries []spatialEntry
+}
+
+// Add stages the establishment, if it has a location.
+func (b *spatialBatch) Add(establishment service.Establishment) {
+	if !establishment.Geocode.Valid {
+		return
+	}
+	var (
+		lat = establishment.Geocode.Latitude
+		lng = establishment.Geocode.Longitude
+	)
+	b.entries = append(b.entries, spatialEntry{
+		hash:      geohash(lat, lng, geohashPrecision),
+		localID:   b.localID,
+		id:        establishment.ID,
+		latitude:  lat,
+		longitude: lng,
+	})
+}
+
+// Commit indexes the staged entries, replacing anything that was previously
+// indexed for the authority.
+func (b *spatialBatch) Commit() {
+	b.index.commit(b.localID, b.entries)
+	b.entries = nil
+}
+
+func (i *SpatialIndex) commit(localID string, entries []spatialEntry) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.remove(localID)
+
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		i.entries[entry.id] = entry
+		ids = append(ids, entry.id)
+	}
+	i.authorities[localID] = ids
+	i.dirty = true
+
+	// Drop the authorities that the text index has evicted. The authority
+	// being committed is kept, as it might not have been committed to the
+	// text index yet.
+	for id := range i.authorities {
+		if id != localID && !i.index.indexed(id) {
+			i.remove(id)
+		}
+	}
+}
+
+// Authorities returns the number of authorities that have been indexed.
+func (i *SpatialIndex) Authorities() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return len(i.authorities)
+}
+
+// Nearby returns every establishment with in the radius (in metres) of the
+// coordinates, nearest first. Establishments that can't be resolved through
+// the text index aren't returned.
+func (i *SpatialIndex) Nearby(lat, lng, radius float64) []Result {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	// The entries are only sorted when they're required, so that adding lots
+	// of authorities at once (i.e. warming) doesn't sort them every time.
+	if i.dirty {
+		i.sorted = i.sorted[:0]
+		for _, entry := range i.entries {
+			i.sorted = append(i.sorted, entry)
+		}
+		sort.Slice(i.sorted, func(a, b int) bool {
+			if i.sorted[a].hash != i.sorted[b].hash {
+				return i.sorted[a].hash < i.sorted[b].hash
+			}
+			return i.sorted[a].id < i.sorted[b].id
+		})
+		i.dirty = false
+	}
+
+	var (
+		entries   = make([]spatialEntry, 0)
+		distances = make([]float64, 0)
+	)
+	for _, cell := range geohashCovering(lat, lng, radius) {
+		start := sort.Search(len(i.sorted), func(k int) bool {
+			return i.sorted[k].hash >= cell
+		})
+		for k := start; k < len(i.sorted) && strings.HasPrefix(i.sorted[k].hash, cell); k++ {
+			var (
+				entry = i.sorted[k]
+				d     = distance(lat, lng, entry.latitude, entry.longitude)
+			)
+			if d > radius {
+				continue
+			}
+			entries = append(entries, entry)
+			distances = append(distances, d)
+		}
+	}
+
+	res := i.index.resolve(entries, distances)
+	sort.Slice(res, func(a, b int) bool {
+		if res[a].Distance != res[b].Distance {
+			return res[a].Distance < res[b].Distance
+		}
+		return res[a].Establishment.ID < res[b].Establishment.ID
+	})
+	return res
+}
+
+// remove removes every entry of the authority.
+// Note: the mutex is expected to be held by the caller.
+func (i *SpatialIndex) remove(localID string) {
+	for _, id := range i.authorities[localID] {
+		if entry, ok := i.entries[id]; ok && entry.localID == localID {
+			delete(i.entries, id)
+			i.dirty = true
+		}
+	}
+	delete(i.authorities, localID)
+}
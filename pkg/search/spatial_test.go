@@ -0,0 +1,178 @@
+package search
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+)
+
+func TestGeohash(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		lat, lng  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{0, 0, 1, "s"},
+		{-90, -180, 2, "00"},
+	} {
+		if expected, actual := test.want, geohash(test.lat, test.lng, test.precision); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	t.Parallel()
+
+	// London to Paris is roughly 343.5km
+	d := distance(51.5074, -0.1278, 48.8566, 2.3522)
+	if expected, actual := 343.5, d/1000; math.Abs(expected-actual) > 1 {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := 0.0, distance(53.8, -1.5, 53.8, -1.5); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestSpatialIndexNearby(t *testing.T) {
+	t.Parallel()
+
+	t.Run("matches scan", func(t *testing.T) {
+		var (
+			rnd            = rand.New(rand.NewSource(1))
+			index          = NewSpatialIndex(NewIndex(0))
+			establishments = make([]service.Establishment, 2000)
+		)
+		for k := range establishments {
+			establishments[k] = service.Establishment{
+				ID: k + 1,
+				Geocode: service.Geocode{
+					Latitude:  53.9 + rnd.Float64()*0.2,
+					Longitude: -1.2 + rnd.Float64()*0.3,
+					Valid:     true,
+				},
+			}
+		}
+		addSpatial(index, "1", establishments)
+
+		for _, radius := range []float64{0, 100, 500, 2000, 10000, 50000} {
+			lat, lng := 54.0, -1.05
+
+			var want []int
+			for _, v := range establishments {
+				if distance(lat, lng, v.Geocode.Latitude, v.Geocode.Longitude) <= radius {
+					want = append(want, v.ID)
+				}
+			}
+			sort.Ints(want)
+
+			var got []int
+			for _, v := range index.Nearby(lat, lng, radius) {
+				got = append(got, v.Establishment.ID)
+			}
+			sort.Ints(got)
+
+			if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("%v: expected: %d, actual: %d", radius, len(expected), len(actual))
+			}
+		}
+	})
+
+	t.Run("nearest first", func(t *testing.T) {
+		index := NewSpatialIndex(NewIndex(0))
+		addSpatial(index, "1", []service.Establishment{
+			service.Establishment{ID: 1, Geocode: service.Geocode{Latitude: 53.802, Longitude: -1.5, Valid: true}},
+			service.Establishment{ID: 2, Geocode: service.Geocode{Latitude: 53.801, Longitude: -1.5, Valid: true}},
+			service.Establishment{ID: 3},
+		})
+		addSpatial(index, "2", []service.Establishment{
+			service.Establishment{ID: 4, Geocode: service.Geocode{Latitude: 53.8, Longitude: -1.5, Valid: true}},
+			service.Establishment{ID: 5, Geocode: service.Geocode{Latitude: 54.8, Longitude: -1.5, Valid: true}},
+		})
+
+		var got []int
+		for _, v := range index.Nearby(53.8, -1.5, 1000) {
+			got = append(got, v.Establishment.ID)
+		}
+		if expected, actual := []int{4, 2, 1}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("replaces authority", func(t *testing.T) {
+		index := NewSpatialIndex(NewIndex(0))
+		addSpatial(index, "1", []service.Establishment{
+			service.Establishment{ID: 1, Geocode: service.Geocode{Latitude: 53.8, Longitude: -1.5, Valid: true}},
+		})
+		addSpatial(index, "1", []service.Establishment{})
+
+		if expected, actual := 0, len(index.Nearby(53.8, -1.5, 1000)); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+	t.Run("resolves through the index", func(t *testing.T) {
+		index := NewSpatialIndex(NewIndex(0))
+		addSpatial(index, "1", []service.Establishment{
+			service.Establishment{
+				ID:           1,
+				Name:         "Bobs Burgers",
+				Rating:       "5",
+				BusinessType: "Takeaway",
+				Geocode:      service.Geocode{Latitude: 53.8, Longitude: -1.5, Valid: true},
+			},
+		})
+
+		want := []Result{
+			Result{
+				LocalID: "1",
+				Establishment: service.Establishment{
+					ID:      1,
+					Name:    "Bobs Burgers",
+					Rating:  "5",
+					Geocode: service.Geocode{Latitude: 53.8, Longitude: -1.5, Valid: true},
+				},
+			},
+		}
+		if expected, actual := want, index.Nearby(53.8, -1.5, 1000); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("evicted with the index", func(t *testing.T) {
+		index := NewSpatialIndex(NewIndex(1))
+		addSpatial(index, "1", []service.Establishment{
+			service.Establishment{ID: 1, Geocode: service.Geocode{Latitude: 53.8, Longitude: -1.5, Valid: true}},
+		})
+		addSpatial(index, "2", []service.Establishment{
+			service.Establishment{ID: 2, Geocode: service.Geocode{Latitude: 53.801, Longitude: -1.5, Valid: true}},
+		})
+
+		var got []int
+		for _, v := range index.Nearby(53.8, -1.5, 1000) {
+			got = append(got, v.Establishment.ID)
+		}
+		if expected, actual := []int{2}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, index.Authorities(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, len(index.entries); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+// addSpatial adds the establishments to the spatial index and the index it
+// resolves through, like NewService does.
+func addSpatial(index *SpatialIndex, localID string, establishments []service.Establishment) {
+	index.index.Add(localID, establishments)
+	index.Add(localID, establishments)
+}
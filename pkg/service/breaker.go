@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CircuitOpenError is returned when the circuit breaker is open and the request
+// was failed fast, with out going to the underlying service.
+type CircuitOpenError struct {
+	// RetryAfter states how long until the breaker will probe the underlying
+	// service again.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open (retry after: %s)", e.RetryAfter)
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breakerService wraps another service, but stops sending requests to it once
+// it has failed repeatedly. Whilst the breaker is open every request fails fast
+// with a CircuitOpenError. Once the cooldown has passed the breaker half-opens
+// and lets a single request through to probe if the underlying service has
+// recovered; if it has then the breaker closes, otherwise it opens again.
+type breakerService struct {
+	service   Service
+	threshold int
+	cooldown  time.Duration
+
+	mutex    sync.Mutex
+	state    breakerState
+	failures int
+	opened   time.Time
+}
+
+// NewBreaker returns a new service that will consume a service, but acts as a
+// circuit breaker. The breaker opens after threshold consecutive failures and
+// stays open for the cooldown.
+func NewBreaker(service Service, threshold int, cooldown time.Duration) Service {
+	return &breakerService{
+		service:   service,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     breakerClosed,
+	}
+}
+
+// Authorities returns a series of Authorities from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *breakerService) Authorities(ctx context.Context) ([]Authority, error) {
+	if err := s.allow(); err != nil {
+		return nil, err
+	}
+	res, err := s.service.Authorities(ctx)
+	s.record(ctx, err)
+	return res, err
+}
+
+// EstablishmentsForAuthority returns a series of Establishments from the
+// underlying API or it returns an error if it was not able to request or
+// parse the result. The Establishments service API takes a Authority
+// LocalID to select the correct set of establishments for that Authority.
+func (s *breakerService) EstablishmentsForAuthority(ctx context.Context, localID string) ([]Establishment, error) {
+	if err := s.allow(); err != nil {
+		return nil, err
+	}
+	res, err := s.service.EstablishmentsForAuthority(ctx, localID)
+	s.record(ctx, err)
+	return res, err
+}
+
+// Establishment returns a single Establishment by it's FHRSID from the
+// underlying API or it returns an error if it was not able to request or parse
+// the result.
+func (s *breakerService) Establishment(ctx context.Context, id int) (Establishment, error) {
+	if err := s.allow(); err != nil {
+		return Establishment{}, err
+	}
+	res, err := s.service.Establishment(ctx, id)
+	s.record(ctx, err)
+	return res, err
+}
+
+// Regions returns a series of Regions from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *breakerService) Regions(ctx context.Context) ([]Region, error) {
+	if err := s.allow(); err != nil {
+		return nil, err
+	}
+	res, err := s.service.Regions(ctx)
+	s.record(ctx, err)
+	return res, err
+}
+
+// Countries returns a series of Countries from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *breakerService) Countries(ctx context.Context) ([]Country, error) {
+	if err := s.allow(); err != nil {
+		return nil, err
+	}
+	res, err := s.service.Countries(ctx)
+	s.record(ctx, err)
+	return res, err
+}
+
+// BusinessTypes returns a series of BusinessTypes from the underlying API or
+// it returns an error if it was not able to request or parse the result.
+func (s *breakerService) BusinessTypes(ctx context.Context) ([]BusinessType, error) {
+	if err := s.allow(); err != nil {
+		return nil, err
+	}
+	res, err := s.service.BusinessTypes(ctx)
+	s.record(ctx, err)
+	return res, err
+}
+
+// SchemeTypes returns a series of SchemeTypes from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *breakerService) SchemeTypes(ctx context.Context) ([]SchemeType, error) {
+	if err := s.allow(); err != nil {
+		return nil, err
+	}
+	res, err := s.service.SchemeTypes(ctx)
+	s.record(ctx, err)
+	return res, err
+}
+
+// Ratings returns a series of Ratings from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *breakerService) Ratings(ctx context.Context) ([]Rating, error) {
+	if err := s.allow(); err != nil {
+		return nil, err
+	}
+	res, err := s.service.Ratings(ctx)
+	s.record(ctx, err)
+	return res, err
+}
+
+// StreamEstablishmentsForAuthority calls fn for every Establishment of the
+// Authority, streaming them if the underlying service supports it.
+func (s *breakerService) StreamEstablishmentsForAuthority(ctx context.Context, localID string, fn func(Establishment) error) error {
+	if err := s.allow(); err != nil {
+		return err
+	}
+	// If the stream was stopped by fn, then that's not a failure of the
+	// underlying service, even if the error was wrapped on the way back.
+	var stopped bool
+	err := StreamEstablishmentsForAuthority(ctx, s.service, localID, func(e Establishment) error {
+		err := fn(e)
+		if err != nil {
+			stopped = true
+		}
+		return err
+	})
+	if stopped {
+		s.record(ctx, nil)
+	} else {
+		s.record(ctx, err)
+	}
+	return err
+}
+
+// allow returns an error if the request isn't allowed through the breaker.
+func (s *breakerService) allow() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch s.state {
+	case breakerOpen:
+		if wait := s.cooldown - time.Since(s.opened); wait > 0 {
+			return &CircuitOpenError{RetryAfter: wait}
+		}
+		// The cooldown has passed, so let this request probe the service.
+		s.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		// Only one probe is allowed at a time.
+		return &CircuitOpenError{RetryAfter: s.cooldown}
+	}
+	return nil
+}
+
+// record records the result of a request that was allowed through the breaker.
+// Only transport errors and the status codes that state the service is failing
+// (5xx) or overloaded (429) count as failures; any other status code means the
+// service answered, even if the request was invalid.
+func (s *breakerService) record(ctx context.Context, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cause := errors.Cause(err)
+	statusErr, ok := cause.(*StatusError)
+
+	switch {
+	case err == nil || cause == ErrNotFound || (ok && !statusErr.Temporary()):
+		// The service answered, even if it didn't know about the entity.
+		s.state = breakerClosed
+		s.failures = 0
+	case ctx.Err() != nil:
+		// The caller went away, which says nothing about the service, so let
+		// another request probe if required.
+		if s.state == breakerHalfOpen {
+			s.state = breakerOpen
+		}
+	default:
+		s.failures++
+		if s.state == breakerHalfOpen || s.failures >= s.threshold {
+			s.state = breakerOpen
+			s.opened = time.Now()
+		}
+	}
+}
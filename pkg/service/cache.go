@@ -1,60 +1,429 @@
 package service
 
 import (
+	"container/list"
+	"context"
+	"strconv"
 	"sync"
+	"time"
 )
 
 // cacheService wraps another service, but caches it's results for the methods.
-// This is a very basic cache, there is no cache eviction or timeouts. It just
-// holds onto values for the lifetime of the application.
+// Values are held onto until they expire (see the TTL options), at which point
+// the next request will go back to the underlying service. The establishments
+// (and single establishments) are also bound by a least recently used (LRU)
+// eviction policy, so that the memory of the cache doesn't grow with every
+// authority browsed.
+// The mutex only guards the cached values, concurrent requests to the underlying
+// service are deduplicated per key by the group, so a slow authority doesn't
+// block the requests for any other authority.
+// Expired values can still be served with in the stale window, whilst they're
+// refreshed in the background, so users don't pay for the upstream latency.
 type cacheService struct {
-	service        Service
-	mutex          sync.Mutex
-	authorities    []Authority
-	establishments map[string][]Establishment
+	service Service
+	mutex   sync.Mutex
+	group   *group
+
+	authoritiesTTL    time.Duration
+	establishmentsTTL time.Duration
+	staleTTL          time.Duration
+	maxEntries        int
+	maxBytes          int
+
+	references map[string]*referenceEntry
+
+	entries map[string]*list.Element
+	lru     *list.List
+	bytes   int
+}
+
+// referenceEntry is the value stored for the authorities and the other
+// reference data (regions, countries, etc), which are small and change rarely,
+// so they're not bound by the LRU.
+type referenceEntry struct {
+	value   interface{}
+	fetched time.Time
+	expires time.Time
+}
+
+// cacheEntry is the value stored with in the LRU list for an authority or a
+// single establishment. The key is the same key used to deduplicate the
+// requests to the underlying service.
+type cacheEntry struct {
+	key            string
+	establishments []Establishment
+	fetched        time.Time
+	expires        time.Time
+	bytes          int
+}
+
+// CacheOption defines a option for configuring the cache service.
+type CacheOption func(*cacheService)
+
+// WithAuthoritiesTTL sets how long the authorities (and the other reference
+// data i.e. regions) are cached for. A zero duration means that the
+// authorities never expire.
+func WithAuthoritiesTTL(ttl time.Duration) CacheOption {
+	return func(s *cacheService) {
+		s.authoritiesTTL = ttl
+	}
+}
+
+// WithEstablishmentsTTL sets how long the establishments for an authority (and
+// single establishments) are cached for. A zero duration means that the establishments never expire.
+func WithEstablishmentsTTL(ttl time.Duration) CacheOption {
+	return func(s *cacheService) {
+		s.establishmentsTTL = ttl
+	}
+}
+
+// WithStaleWhileRevalidate sets how long after expiring a value can still be
+// served, whilst it's refreshed in the background. A zero duration means that
+// expired values are never served.
+func WithStaleWhileRevalidate(window time.Duration) CacheOption {
+	return func(s *cacheService) {
+		s.staleTTL = window
+	}
+}
+
+// WithMaxEntries sets the maximum number of authorities (and single
+// establishments) that can be cached at any one time. A zero value means there is no limit.
+func WithMaxEntries(n int) CacheOption {
+	return func(s *cacheService) {
+		s.maxEntries = n
+	}
+}
+
+// WithMaxBytes sets the maximum number of (estimated) bytes that the cached
+// establishments can occupy. A zero value means there is no limit.
+func WithMaxBytes(n int) CacheOption {
+	return func(s *cacheService) {
+		s.maxBytes = n
+	}
 }
 
 // NewCache returns a new service that will consume a service, but acts as
-// middleware for caching the results.
-func NewCache(service Service) Service {
-	return &cacheService{
-		service:        service,
-		mutex:          sync.Mutex{},
-		authorities:    make([]Authority, 0),
-		establishments: make(map[string][]Establishment),
+// middleware for caching the results. Without any options the cache behaves
+// as it always has; holding onto values for the lifetime of the application.
+func NewCache(service Service, options ...CacheOption) Service {
+	s := &cacheService{
+		service:    service,
+		mutex:      sync.Mutex{},
+		group:      newGroup(),
+		references: make(map[string]*referenceEntry),
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+	for _, option := range options {
+		option(s)
 	}
+	return s
 }
 
 // Authorities returns a series of Authorities from the underlying API or it
 // returns an error if it was not able to request or parse the result.
-func (s *cacheService) Authorities() ([]Authority, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+func (s *cacheService) Authorities(ctx context.Context) ([]Authority, error) {
+	res, err := s.reference(ctx, authoritiesKey, func(ctx context.Context) (interface{}, int, error) {
+		res, err := s.service.Authorities(ctx)
+		return res, len(res), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]Authority), nil
+}
+
+// Regions returns a series of Regions from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *cacheService) Regions(ctx context.Context) ([]Region, error) {
+	res, err := s.reference(ctx, regionsKey, func(ctx context.Context) (interface{}, int, error) {
+		res, err := s.service.Regions(ctx)
+		return res, len(res), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]Region), nil
+}
+
+// Countries returns a series of Countries from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *cacheService) Countries(ctx context.Context) ([]Country, error) {
+	res, err := s.reference(ctx, countriesKey, func(ctx context.Context) (interface{}, int, error) {
+		res, err := s.service.Countries(ctx)
+		return res, len(res), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]Country), nil
+}
+
+// BusinessTypes returns a series of BusinessTypes from the underlying API or
+// it returns an error if it was not able to request or parse the result.
+func (s *cacheService) BusinessTypes(ctx context.Context) ([]BusinessType, error) {
+	res, err := s.reference(ctx, businessTypesKey, func(ctx context.Context) (interface{}, int, error) {
+		res, err := s.service.BusinessTypes(ctx)
+		return res, len(res), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]BusinessType), nil
+}
+
+// SchemeTypes returns a series of SchemeTypes from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *cacheService) SchemeTypes(ctx context.Context) ([]SchemeType, error) {
+	res, err := s.reference(ctx, schemeTypesKey, func(ctx context.Context) (interface{}, int, error) {
+		res, err := s.service.SchemeTypes(ctx)
+		return res, len(res), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]SchemeType), nil
+}
+
+// Ratings returns a series of Ratings from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *cacheService) Ratings(ctx context.Context) ([]Rating, error) {
+	res, err := s.reference(ctx, ratingsKey, func(ctx context.Context) (interface{}, int, error) {
+		res, err := s.service.Ratings(ctx)
+		return res, len(res), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]Rating), nil
+}
 
-	if len(s.authorities) > 0 {
-		return s.authorities, nil
+// reference returns the reference data for the key if it's fresh (or stale with
+// in the window), otherwise it's requested from the underlying service. The
+// request returns the value along with it's length, as empty values aren't
+// cached.
+func (s *cacheService) reference(ctx context.Context, key string, request func(context.Context) (interface{}, int, error)) (interface{}, error) {
+	fetch := s.fetchReference(key, request)
+
+	s.mutex.Lock()
+	if entry, ok := s.references[key]; ok {
+		age := time.Since(entry.fetched)
+		switch {
+		case !s.expired(entry.expires):
+			s.mutex.Unlock()
+			recordFreshness(ctx, FreshnessFresh, age)
+			return entry.value, nil
+		case s.stale(entry.expires):
+			s.mutex.Unlock()
+			s.revalidate(key, fetch)
+			recordFreshness(ctx, FreshnessStale, age)
+			return entry.value, nil
+		}
 	}
-	res, err := s.service.Authorities()
-	if err == nil {
-		s.authorities = res
+	s.mutex.Unlock()
+
+	res, err := s.group.Do(ctx, key, fetch)
+	if err != nil {
+		return nil, err
 	}
-	return res, err
+	recordFreshness(ctx, FreshnessMiss, 0)
+	return res, nil
 }
 
 // EstablishmentsForAuthority returns a series of Establishments from the
 // underlying API or it returns an error if it was not able to request or
 // parse the result. The Establishments service API takes a Authority
 // LocalID to select the correct set of establishments for that Authority.
-func (s *cacheService) EstablishmentsForAuthority(localID string) ([]Establishment, error) {
+func (s *cacheService) EstablishmentsForAuthority(ctx context.Context, localID string) ([]Establishment, error) {
+	return s.lookup(ctx, establishmentsKey+localID, s.fetchEstablishments(localID))
+}
+
+// Establishment returns a single Establishment by it's FHRSID from the
+// underlying API or it returns an error if it was not able to request or parse
+// the result.
+func (s *cacheService) Establishment(ctx context.Context, id int) (Establishment, error) {
+	res, err := s.lookup(ctx, establishmentKey+strconv.Itoa(id), s.fetchEstablishment(id))
+	if err != nil {
+		return Establishment{}, err
+	}
+	return res[0], nil
+}
+
+// lookup returns the establishments for the key from the LRU if they're fresh
+// (or stale with in the window), otherwise they're fetched from the underlying
+// service.
+func (s *cacheService) lookup(ctx context.Context, key string, fetch func(context.Context) (interface{}, error)) ([]Establishment, error) {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		var (
+			entry = elem.Value.(*cacheEntry)
+			age   = time.Since(entry.fetched)
+		)
+		if len(entry.establishments) > 0 {
+			switch {
+			case !s.expired(entry.expires):
+				s.lru.MoveToFront(elem)
+				s.mutex.Unlock()
+				recordFreshness(ctx, FreshnessFresh, age)
+				return entry.establishments, nil
+			case s.stale(entry.expires):
+				s.lru.MoveToFront(elem)
+				s.mutex.Unlock()
+				s.revalidate(key, fetch)
+				recordFreshness(ctx, FreshnessStale, age)
+				return entry.establishments, nil
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	res, err := s.group.Do(ctx, key, fetch)
+	if err != nil {
+		return nil, err
+	}
+	recordFreshness(ctx, FreshnessMiss, 0)
+	return res.([]Establishment), nil
+}
+
+// fetchReference returns a function that requests the reference data from the
+// underlying service and stores it if successful.
+func (s *cacheService) fetchReference(key string, request func(context.Context) (interface{}, int, error)) func(context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		res, n, err := request(ctx)
+		if err == nil && n > 0 {
+			s.mutex.Lock()
+			s.references[key] = &referenceEntry{
+				value:   res,
+				fetched: time.Now(),
+				expires: s.expiry(s.authoritiesTTL),
+			}
+			s.mutex.Unlock()
+		}
+		return res, err
+	}
+}
+
+// fetchEstablishments returns a function that requests the establishments for
+// an authority from the underlying service and stores them if successful.
+func (s *cacheService) fetchEstablishments(localID string) func(context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		res, err := s.service.EstablishmentsForAuthority(ctx, localID)
+		if err == nil {
+			s.mutex.Lock()
+			s.add(establishmentsKey+localID, res)
+			s.mutex.Unlock()
+		}
+		return res, err
+	}
+}
+
+// fetchEstablishment returns a function that requests a single establishment
+// from the underlying service and stores it if successful.
+func (s *cacheService) fetchEstablishment(id int) func(context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		res, err := s.service.Establishment(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		establishments := []Establishment{res}
+		s.mutex.Lock()
+		s.add(establishmentKey+strconv.Itoa(id), establishments)
+		s.mutex.Unlock()
+		return establishments, nil
+	}
+}
+
+// revalidate refreshes a value in the background. The refresh isn't bound to
+// the callers context, as the caller has already been served the stale value.
+// If the refresh fails, the stale value is left in place until the next
+// request tries again.
+func (s *cacheService) revalidate(key string, fetch func(context.Context) (interface{}, error)) {
+	go s.group.Do(context.Background(), key, fetch)
+}
+
+// add inserts the establishments to the front of the LRU and then evicts the
+// least recently used entries until the cache is with in it's bounds.
+// Note: the mutex is expected to be held by the caller.
+func (s *cacheService) add(key string, establishments []Establishment) {
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+
+	entry := &cacheEntry{
+		key:            key,
+		establishments: establishments,
+		fetched:        time.Now(),
+		expires:        s.expiry(s.establishmentsTTL),
+		bytes:          estimateBytes(key, establishments),
+	}
+	s.entries[key] = s.lru.PushFront(entry)
+	s.bytes += entry.bytes
+
+	for s.lru.Len() > 0 && s.overflowing() {
+		s.remove(s.lru.Back())
+	}
+}
+
+// remove removes the element from both the LRU and the lookup.
+func (s *cacheService) remove(elem *list.Element) {
+	entry := s.lru.Remove(elem).(*cacheEntry)
+	delete(s.entries, entry.key)
+	s.bytes -= entry.bytes
+}
+
+func (s *cacheService) overflowing() bool {
+	return (s.maxEntries > 0 && s.lru.Len() > s.maxEntries) ||
+		(s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
 
-	if e, ok := s.establishments[localID]; ok && len(e) > 0 {
-		return e, nil
+// expiry returns the time at which a value expires given a ttl. A zero time
+// means that the value never expires.
+func (s *cacheService) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
 	}
-	res, err := s.service.EstablishmentsForAuthority(localID)
-	if err == nil {
-		s.establishments[localID] = res
+	return time.Now().Add(ttl)
+}
+
+func (s *cacheService) expired(expires time.Time) bool {
+	return !expires.IsZero() && !time.Now().Before(expires)
+}
+
+// stale returns if an expired value can still be served with in the stale
+// window.
+func (s *cacheService) stale(expires time.Time) bool {
+	return s.staleTTL > 0 && time.Now().Before(expires.Add(s.staleTTL))
+}
+
+// These are the keys used to deduplicate the requests to the underlying service.
+const (
+	authoritiesKey    = "authorities"
+	regionsKey        = "regions"
+	countriesKey      = "countries"
+	businessTypesKey  = "businesstypes"
+	schemeTypesKey    = "schemetypes"
+	ratingsKey        = "ratings"
+	establishmentsKey = "establishments:"
+	establishmentKey  = "establishment:"
+)
+
+// These are rough estimations of how much memory a value occupies, they're
+// not meant to be exact, just good enough to bound the cache.
+// The size of an Establishment is the fixed size of the struct, without the
+// contents of the strings.
+const (
+	sizeOfEstablishment = 256
+	sizeOfEntry         = 128
+)
+
+// estimateBytes returns an estimated number of bytes the establishments will
+// occupy in memory.
+func estimateBytes(key string, establishments []Establishment) int {
+	n := sizeOfEntry + len(key)
+	for _, v := range establishments {
+		n += sizeOfEstablishment + len(v.Name) + len(v.BusinessType) +
+			len(v.Address1) + len(v.Address2) + len(v.Address3) + len(v.Address4) +
+			len(v.PostCode) + len(v.Rating) + len(v.Scheme)
 	}
-	return res, err
+	return n
 }
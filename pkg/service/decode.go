@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// decodeEstablishments decodes the Establishments JSON payload from the reader
+// a token at a time, calling fn for every Establishment with in the
+// "establishments" array as soon as it's decoded. This means that the whole
+// payload is never held in memory at once. The meta of the payload is
+// returned once everything has been decoded.
+func decodeEstablishments(r io.Reader, fn func(Establishment) error) (Meta, error) {
+	var (
+		meta Meta
+		dec  = json.NewDecoder(r)
+	)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return meta, err
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return meta, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return meta, errors.Errorf("invalid payload (unexpected token: %v)", token)
+		}
+
+		switch key {
+		case "establishments":
+			token, err := dec.Token()
+			if err != nil {
+				return meta, err
+			}
+			// The establishments can be null, if there are none.
+			if token == nil {
+				continue
+			}
+			if delim, ok := token.(json.Delim); !ok || delim != '[' {
+				return meta, errors.Errorf("invalid payload (unexpected token: %v)", token)
+			}
+			for dec.More() {
+				var e Establishment
+				if err := dec.Decode(&e); err != nil {
+					return meta, err
+				}
+				if err := fn(e); err != nil {
+					return meta, err
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return meta, err
+			}
+
+		case "meta":
+			if err := dec.Decode(&meta); err != nil {
+				return meta, err
+			}
+
+		default:
+			// Skip anything we don't require.
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return meta, err
+			}
+		}
+	}
+
+	return meta, expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token, returning an error if it's not the delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return errors.Errorf("invalid payload (expected: %v, actual: %v)", delim, token)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeEstablishments(t *testing.T) {
+	t.Parallel()
+
+	t.Run("establishments", func(t *testing.T) {
+		payload := `{
+			"establishments": [
+				{"BusinessName": "Bobs Burgers", "RatingValue": "4", "FHRSID": 1},
+				{"BusinessName": "Petes Pizza", "RatingValue": "Exempt"}
+			],
+			"meta": {"pageNumber": 1, "pageSize": 2, "totalCount": 2, "totalPages": 1},
+			"links": [{"rel": "self", "href": "http://example.com"}]
+		}`
+
+		var got []Establishment
+		meta, err := decodeEstablishments(strings.NewReader(payload), func(e Establishment) error {
+			got = append(got, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []Establishment{
+			Establishment{ID: 1, Name: "Bobs Burgers", Rating: "4"},
+			Establishment{Name: "Petes Pizza", Rating: "Exempt"},
+		}
+		if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := (Meta{1, 2, 2, 1}), meta; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("null", func(t *testing.T) {
+		var n int
+		_, err := decodeEstablishments(strings.NewReader(`{"establishments": null}`), func(Establishment) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 0, n; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		var (
+			n       int
+			stop    = errors.New("stop")
+			payload = `{"establishments": [{"BusinessName": "a"}, {"BusinessName": "b"}]}`
+		)
+		_, err := decodeEstablishments(strings.NewReader(payload), func(Establishment) error {
+			n++
+			return stop
+		})
+		if expected, actual := stop, err; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, n; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, payload := range []string{
+			``,
+			`[]`,
+			`{"establishments": {}}`,
+			`{"establishments": [`,
+			`{"establishments": [}`,
+		} {
+			_, err := decodeEstablishments(strings.NewReader(payload), func(Establishment) error {
+				return nil
+			})
+			if err == nil {
+				t.Errorf("(%q): expected error", payload)
+			}
+		}
+	})
+}
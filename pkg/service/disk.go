@@ -0,0 +1,360 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// These define the on-disk record format. Every record is a single file with a
+// header line, followed by the JSON payload:
+//
+//	hygiene/<version> <crc32 of payload> <fetched unix nano>\n
+//	<payload>
+//
+// If the format of the record (or the payload) changes, then the version needs
+// to be bumped, so that old records are discarded rather than misread.
+const (
+	diskRecordMagic   = "hygiene"
+	diskRecordVersion = 3
+	diskRecordExt     = ".rec"
+	diskTempExt       = ".tmp"
+
+	diskAuthoritiesKey       = "authorities"
+	diskRegionsKey           = "regions"
+	diskCountriesKey         = "countries"
+	diskBusinessTypesKey     = "businesstypes"
+	diskSchemeTypesKey       = "schemetypes"
+	diskRatingsKey           = "ratings"
+	diskEstablishmentsPrefix = "establishments-"
+	diskEstablishmentPrefix  = "establishment-"
+)
+
+// diskService wraps another service, persisting the results to a local
+// directory, so that they survive restarts of the application. The records are
+// validated on startup and invalid ones are removed. Only the index of the
+// records is held in memory, the payloads are read from disk when requested.
+type diskService struct {
+	service Service
+	dir     string
+	ttl     time.Duration
+	logger  log.Logger
+
+	mutex sync.RWMutex
+	index map[string]time.Time
+}
+
+// NewDisk returns a new service that will consume a service, but persists the
+// results to the directory. Records older than the ttl are requested again
+// from the underlying service, but if that fails then the old record is used.
+// A zero ttl means that the records never expire.
+// The disk service can be stacked with NewCache to also keep the results in
+// memory.
+func NewDisk(service Service, dir string, ttl time.Duration, logger log.Logger) (Service, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "error creating cache directory %q", dir)
+	}
+
+	s := &diskService{
+		service: service,
+		dir:     dir,
+		ttl:     ttl,
+		logger:  logger,
+		index:   make(map[string]time.Time),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Authorities returns a series of Authorities from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *diskService) Authorities(ctx context.Context) ([]Authority, error) {
+	var res []Authority
+	err := s.fetch(diskAuthoritiesKey, &res, func() (interface{}, int, error) {
+		var err error
+		res, err = s.service.Authorities(ctx)
+		return res, len(res), err
+	})
+	return res, err
+}
+
+// EstablishmentsForAuthority returns a series of Establishments from the
+// underlying API or it returns an error if it was not able to request or
+// parse the result. The Establishments service API takes a Authority
+// LocalID to select the correct set of establishments for that Authority.
+func (s *diskService) EstablishmentsForAuthority(ctx context.Context, localID string) ([]Establishment, error) {
+	var (
+		res []Establishment
+		// The localID can come from anywhere, so make sure it's safe to use as
+		// a file name.
+		key = diskEstablishmentsPrefix + hex.EncodeToString([]byte(localID))
+	)
+	err := s.fetch(key, &res, func() (interface{}, int, error) {
+		var err error
+		res, err = s.service.EstablishmentsForAuthority(ctx, localID)
+		return res, len(res), err
+	})
+	return res, err
+}
+
+// Establishment returns a single Establishment by it's FHRSID from the
+// underlying API or it returns an error if it was not able to request or parse
+// the result.
+func (s *diskService) Establishment(ctx context.Context, id int) (Establishment, error) {
+	var (
+		res Establishment
+		key = diskEstablishmentPrefix + strconv.Itoa(id)
+	)
+	err := s.fetch(key, &res, func() (interface{}, int, error) {
+		var err error
+		res, err = s.service.Establishment(ctx, id)
+		return res, 1, err
+	})
+	return res, err
+}
+
+// Regions returns a series of Regions from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *diskService) Regions(ctx context.Context) ([]Region, error) {
+	var res []Region
+	err := s.fetch(diskRegionsKey, &res, func() (interface{}, int, error) {
+		var err error
+		res, err = s.service.Regions(ctx)
+		return res, len(res), err
+	})
+	return res, err
+}
+
+// Countries returns a series of Countries from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *diskService) Countries(ctx context.Context) ([]Country, error) {
+	var res []Country
+	err := s.fetch(diskCountriesKey, &res, func() (interface{}, int, error) {
+		var err error
+		res, err = s.service.Countries(ctx)
+		return res, len(res), err
+	})
+	return res, err
+}
+
+// BusinessTypes returns a series of BusinessTypes from the underlying API or
+// it returns an error if it was not able to request or parse the result.
+func (s *diskService) BusinessTypes(ctx context.Context) ([]BusinessType, error) {
+	var res []BusinessType
+	err := s.fetch(diskBusinessTypesKey, &res, func() (interface{}, int, error) {
+		var err error
+		res, err = s.service.BusinessTypes(ctx)
+		return res, len(res), err
+	})
+	return res, err
+}
+
+// SchemeTypes returns a series of SchemeTypes from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *diskService) SchemeTypes(ctx context.Context) ([]SchemeType, error) {
+	var res []SchemeType
+	err := s.fetch(diskSchemeTypesKey, &res, func() (interface{}, int, error) {
+		var err error
+		res, err = s.service.SchemeTypes(ctx)
+		return res, len(res), err
+	})
+	return res, err
+}
+
+// Ratings returns a series of Ratings from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *diskService) Ratings(ctx context.Context) ([]Rating, error) {
+	var res []Rating
+	err := s.fetch(diskRatingsKey, &res, func() (interface{}, int, error) {
+		var err error
+		res, err = s.service.Ratings(ctx)
+		return res, len(res), err
+	})
+	return res, err
+}
+
+// fetch reads the record for the key into v, if the record doesn't exist or has
+// expired then the request is used to get a new value, which is then persisted.
+// The request is expected to populate v itself and returns the value along
+// with it's length, as empty values aren't persisted (the same as the cache),
+// so that an empty response isn't served for the whole of the ttl.
+func (s *diskService) fetch(key string, v interface{}, request func() (interface{}, int, error)) error {
+	s.mutex.RLock()
+	fetched, ok := s.index[key]
+	s.mutex.RUnlock()
+
+	if ok && !s.expired(fetched) {
+		err := s.read(key, v)
+		if err == nil {
+			return nil
+		}
+		level.Warn(s.logger).Log("key", key, "err", err)
+	}
+
+	res, n, err := request()
+	if err != nil {
+		// If we've got an old record, then that's better than nothing.
+		if ok && s.read(key, v) == nil {
+			level.Warn(s.logger).Log("key", key, "state", "expired", "err", err)
+			return nil
+		}
+		return err
+	}
+
+	if n == 0 {
+		return nil
+	}
+	if err := s.write(key, res); err != nil {
+		// Failing to persist shouldn't fail the request.
+		level.Warn(s.logger).Log("key", key, "err", err)
+	}
+	return nil
+}
+
+func (s *diskService) expired(fetched time.Time) bool {
+	return s.ttl > 0 && time.Since(fetched) >= s.ttl
+}
+
+// load validates all the records in the directory and builds the index from
+// them. Any records that are corrupt or from an older version are removed, as
+// are any temporary files left behind by a write that never finished (i.e. a
+// crash before the rename).
+func (s *diskService) load() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return errors.Wrapf(err, "error reading cache directory %q", s.dir)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() {
+			continue
+		}
+		if filepath.Ext(name) == diskTempExt {
+			level.Debug(s.logger).Log("file", name, "state", "removing", "err", "unfinished write")
+			os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		if filepath.Ext(name) != diskRecordExt {
+			continue
+		}
+
+		key := strings.TrimSuffix(name, diskRecordExt)
+		fetched, _, err := s.readRecord(key)
+		if err != nil {
+			level.Warn(s.logger).Log("key", key, "state", "removing", "err", err)
+			os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		s.index[key] = fetched
+	}
+
+	level.Debug(s.logger).Log("dir", s.dir, "records", len(s.index))
+	return nil
+}
+
+// read reads the payload of the record for the key into v.
+func (s *diskService) read(key string, v interface{}) error {
+	_, payload, err := s.readRecord(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// readRecord reads and validates the record for the key, returning when it was
+// fetched and the payload.
+func (s *diskService) readRecord(key string) (time.Time, []byte, error) {
+	b, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+
+	header, err := bufio.NewReader(bytes.NewReader(b)).ReadString('\n')
+	if err != nil {
+		return time.Time{}, nil, errors.Errorf("invalid record %q (missing header)", key)
+	}
+
+	var (
+		version  int
+		checksum uint32
+		fetched  int64
+	)
+	if _, err := fmt.Sscanf(header, diskRecordMagic+"/%d %08x %d\n", &version, &checksum, &fetched); err != nil {
+		return time.Time{}, nil, errors.Wrapf(err, "invalid record %q (malformed header)", key)
+	}
+	if version != diskRecordVersion {
+		return time.Time{}, nil, errors.Errorf("invalid record %q (version: %d)", key, version)
+	}
+
+	payload := b[len(header):]
+	if actual := crc32.ChecksumIEEE(payload); actual != checksum {
+		return time.Time{}, nil, errors.Errorf("invalid record %q (checksum: %08x)", key, actual)
+	}
+
+	return time.Unix(0, fetched), payload, nil
+}
+
+// write persists the value as a record for the key. The record is written to a
+// temporary file first and then renamed, so a partially written record is never
+// read.
+func (s *diskService) write(key string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	fetched := time.Now()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, diskRecordMagic+"/%d %08x %d\n", diskRecordVersion, crc32.ChecksumIEEE(payload), fetched.UnixNano())
+	buf.Write(payload)
+
+	// The record is written to a temporary file and then renamed, so that a
+	// record is never half written. The extension lets load find the temporary
+	// files that never made it.
+	tmp, err := ioutil.TempFile(s.dir, key+"-*"+diskTempExt)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	s.mutex.Lock()
+	s.index[key] = fetched
+	s.mutex.Unlock()
+
+	return nil
+}
+
+func (s *diskService) path(key string) string {
+	return filepath.Join(s.dir, key+diskRecordExt)
+}
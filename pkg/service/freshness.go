@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// FreshnessStatus describes where a result from a service came from.
+type FreshnessStatus string
+
+// These are the possible freshness statuses of a result.
+const (
+	// FreshnessMiss states that the result came from the underlying API.
+	FreshnessMiss FreshnessStatus = "miss"
+	// FreshnessFresh states that the result came from the cache and is with in
+	// it's time to live.
+	FreshnessFresh FreshnessStatus = "fresh"
+	// FreshnessStale states that the result came from the cache, but has
+	// expired and is being refreshed in the background.
+	FreshnessStale FreshnessStatus = "stale"
+)
+
+// Freshness describes how fresh a result from a service is. The zero value
+// means that the service didn't record anything i.e. there is no cache.
+type Freshness struct {
+	Status FreshnessStatus
+	Age    time.Duration
+}
+
+type freshnessKey struct{}
+
+// WithFreshness returns a new context that allows a service to record the
+// freshness of the result of a request made with the context. The freshness is
+// only valid once the request has returned.
+func WithFreshness(ctx context.Context) (context.Context, *Freshness) {
+	f := &Freshness{}
+	return context.WithValue(ctx, freshnessKey{}, f), f
+}
+
+// recordFreshness records the freshness of a result if the context was created
+// using WithFreshness.
+func recordFreshness(ctx context.Context, status FreshnessStatus, age time.Duration) {
+	if f, ok := ctx.Value(freshnessKey{}).(*Freshness); ok {
+		f.Status = status
+		f.Age = age
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// group deduplicates in-flight requests, so that concurrent requests for the
+// same key share one request to the underlying service. Requests for different
+// keys don't block each other.
+type group struct {
+	mutex sync.Mutex
+	calls map[string]*call
+}
+
+// call is an in-flight or completed request for a key.
+type call struct {
+	ctx  context.Context
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+func newGroup() *group {
+	return &group{
+		calls: make(map[string]*call),
+	}
+}
+
+// Do executes and returns the results of fn, making sure that only one
+// execution is in-flight for a given key at a time. If a duplicate comes in,
+// the duplicate caller waits for the original to complete and receives the
+// same results, unless the duplicate callers context is done first.
+func (g *group) Do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	for {
+		g.mutex.Lock()
+		if c, ok := g.calls[key]; ok {
+			g.mutex.Unlock()
+
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
+			// If the original caller went away, then the error belongs to them
+			// and not us, so try again.
+			if c.err != nil && c.ctx.Err() != nil && ctx.Err() == nil {
+				continue
+			}
+			return c.val, c.err
+		}
+
+		c := &call{
+			ctx:  ctx,
+			done: make(chan struct{}),
+		}
+		g.calls[key] = c
+		g.mutex.Unlock()
+
+		c.val, c.err = fn(ctx)
+
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+
+		close(c.done)
+
+		return c.val, c.err
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// limiter limits the rate of the requests sent to the underlying API using a
+// token bucket. The bucket holds up to burst tokens and is refilled at rate
+// tokens per second; every request takes a token, waiting for one if the
+// bucket is empty. The real service takes a token for every HTTP request it
+// sends, including every page and every retry, so every caller of the service
+// (warm ups, cache misses, etc) shares a global budget for the underlying API.
+type limiter struct {
+	rate  float64
+	burst float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter creates a limiter that allows rate requests per second, with
+// bursts of up to burst requests.
+// Note: the rate is expected to be greater than zero.
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token from the bucket, blocking until one is available or the
+// context is done.
+func (l *limiter) wait(ctx context.Context) error {
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// Reserve the token now, so that waiting callers are served in order.
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Hand the reserved token back, as we're not going to use it.
+		l.mutex.Lock()
+		l.tokens++
+		l.mutex.Unlock()
+		return ctx.Err()
+	}
+}
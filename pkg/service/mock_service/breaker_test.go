@@ -0,0 +1,309 @@
+package mock_service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+)
+
+func TestBreakerService(t *testing.T) {
+	t.Parallel()
+
+	t.Run("closed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewBreaker(mock, 2, time.Hour)
+		)
+
+		// Failures that aren't consecutive shouldn't open the breaker.
+		gomock.InOrder(
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "0").
+				Return(nil, errors.New("something went wrong")),
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "0").
+				Return([]service.Establishment{}, nil),
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "0").
+				Return(nil, errors.New("something went wrong")),
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "0").
+				Return([]service.Establishment{}, nil),
+		)
+
+		for i := 0; i < 4; i++ {
+			_, err := api.EstablishmentsForAuthority(context.Background(), "0")
+			if _, ok := err.(*service.CircuitOpenError); ok {
+				t.Errorf("expected: closed, actual: %v", err)
+			}
+		}
+	})
+
+	t.Run("open", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewBreaker(mock, 2, time.Hour)
+		)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return(nil, errors.New("something went wrong")).
+			Times(2)
+
+		for i := 0; i < 2; i++ {
+			if _, err := api.Authorities(context.Background()); err == nil {
+				t.Errorf("expected error")
+			}
+		}
+
+		// The breaker is shared, so this should fail fast with out the mock.
+		_, err := api.EstablishmentsForAuthority(context.Background(), "0")
+		e, ok := err.(*service.CircuitOpenError)
+		if expected, actual := true, ok; expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := true, e.RetryAfter > 0 && e.RetryAfter <= time.Hour; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("half open recovered", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewBreaker(mock, 1, time.Millisecond)
+		)
+
+		gomock.InOrder(
+			mock.EXPECT().
+				Authorities(gomock.Any()).
+				Return(nil, errors.New("something went wrong")),
+			mock.EXPECT().
+				Authorities(gomock.Any()).
+				Return([]service.Authority{}, nil).
+				Times(2),
+		)
+
+		if _, err := api.Authorities(context.Background()); err == nil {
+			t.Errorf("expected error")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		// The probe should succeed and close the breaker.
+		for i := 0; i < 2; i++ {
+			if _, err := api.Authorities(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	t.Run("half open failed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewBreaker(mock, 3, 20*time.Millisecond)
+		)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return(nil, errors.New("something went wrong")).
+			Times(4)
+
+		for i := 0; i < 3; i++ {
+			if _, err := api.Authorities(context.Background()); err == nil {
+				t.Errorf("expected error")
+			}
+		}
+
+		time.Sleep(30 * time.Millisecond)
+
+		// The probe fails, so the breaker should open straight away again.
+		if _, err := api.Authorities(context.Background()); err == nil {
+			t.Errorf("expected error")
+		}
+		_, err := api.Authorities(context.Background())
+		if _, ok := err.(*service.CircuitOpenError); !ok {
+			t.Errorf("expected: open, actual: %v", err)
+		}
+	})
+
+	t.Run("single probe", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			started = make(chan struct{})
+			release = make(chan struct{})
+			mock    = NewMockService(ctrl)
+			probing = false
+			api     = service.NewBreaker(hookService{mock, func(string) {
+				if probing {
+					close(started)
+					<-release
+				}
+			}}, 1, time.Millisecond)
+		)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return(nil, errors.New("something went wrong"))
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{}, nil)
+
+		if _, err := api.Authorities(context.Background()); err == nil {
+			t.Errorf("expected error")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+		probing = true
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if _, err := api.EstablishmentsForAuthority(context.Background(), "0"); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		<-started
+
+		// Whilst the probe is in-flight, everything else fails fast.
+		_, err := api.Authorities(context.Background())
+		if _, ok := err.(*service.CircuitOpenError); !ok {
+			t.Errorf("expected: open, actual: %v", err)
+		}
+
+		close(release)
+		<-done
+	})
+}
+
+func TestBreakerServiceNotFound(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		mock = NewMockService(ctrl)
+		api  = service.NewBreaker(mock, 1, time.Hour)
+	)
+
+	// The service answered, so not found shouldn't open the breaker.
+	mock.EXPECT().
+		Establishment(gomock.Any(), 123).
+		Return(service.Establishment{}, service.ErrNotFound).
+		Times(2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := api.Establishment(context.Background(), 123); err != service.ErrNotFound {
+			t.Errorf("expected: %v, actual: %v", service.ErrNotFound, err)
+		}
+	}
+}
+
+func TestBreakerServiceStatus(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		code int
+		open bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusForbidden, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+	} {
+		ctrl := gomock.NewController(t)
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewBreaker(mock, 1, time.Hour)
+		)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return(nil, errors.Wrap(&service.StatusError{Code: test.code}, "error requesting authorities"))
+		if !test.open {
+			mock.EXPECT().
+				Authorities(gomock.Any()).
+				Return([]service.Authority{}, nil)
+		}
+
+		api.Authorities(context.Background())
+
+		// Only the status codes of a failing service should open the breaker.
+		_, err := api.Authorities(context.Background())
+		if _, ok := err.(*service.CircuitOpenError); ok != test.open {
+			t.Errorf("%d: expected: %v, actual: %v", test.code, test.open, ok)
+		}
+
+		ctrl.Finish()
+	}
+}
+
+func TestBreakerServiceStreamStopped(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		mock = NewMockService(ctrl)
+		api  = service.NewBreaker(wrappingStreamer{mock}, 1, time.Hour)
+	)
+
+	mock.EXPECT().
+		EstablishmentsForAuthority(gomock.Any(), "0").
+		Return([]service.Establishment{service.Establishment{ID: 1}}, nil).
+		Times(2)
+
+	// Stopping the stream isn't a failure of the service, even if the error
+	// is wrapped by the time it's returned.
+	stop := errors.New("stop")
+	for i := 0; i < 2; i++ {
+		err := service.StreamEstablishmentsForAuthority(context.Background(), api, "0", func(service.Establishment) error {
+			return stop
+		})
+		if expected, actual := stop, errors.Cause(err); expected != actual {
+			t.Errorf("expected: %v, actual: %v (%v)", expected, actual, err)
+		}
+	}
+}
+
+// wrappingStreamer is a service.Streamer that wraps the errors of the stream,
+// like the pages of the real service do.
+type wrappingStreamer struct {
+	service.Service
+}
+
+func (s wrappingStreamer) StreamEstablishmentsForAuthority(ctx context.Context, localID string, fn func(service.Establishment) error) error {
+	establishments, err := s.EstablishmentsForAuthority(ctx, localID)
+	if err != nil {
+		return err
+	}
+	for _, v := range establishments {
+		if err := fn(v); err != nil {
+			return errors.Wrap(err, "error requesting page 1 of 1")
+		}
+	}
+	return nil
+}
@@ -1,8 +1,12 @@
 package mock_service
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/SimonRichardson/foodhygiene/pkg/service"
 	"github.com/golang/mock/gomock"
@@ -23,10 +27,10 @@ func TestCacheServiceAuthorities(t *testing.T) {
 		)
 
 		mock.EXPECT().
-			Authorities().
+			Authorities(gomock.Any()).
 			Return([]service.Authority{}, nil)
 
-		_, err := api.Authorities()
+		_, err := api.Authorities(context.Background())
 		if expected, actual := true, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
@@ -46,22 +50,85 @@ func TestCacheServiceAuthorities(t *testing.T) {
 		)
 
 		mock.EXPECT().
-			Authorities().
+			Authorities(gomock.Any()).
 			Return([]service.Authority{auth}, nil)
 
-		_, err := api.Authorities()
+		_, err := api.Authorities(context.Background())
 		if expected, actual := true, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 
 		// This should use the cache and not the mock.
-		_, err = api.Authorities()
+		_, err = api.Authorities(context.Background())
 		if expected, actual := true, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
 }
 
+func TestCacheServiceReferences(t *testing.T) {
+	t.Parallel()
+
+	t.Run("repeated", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock   = NewMockService(ctrl)
+			api    = service.NewCache(mock)
+			region = service.Region{
+				ID:   1,
+				Name: "Yorkshire and Humberside",
+			}
+		)
+
+		mock.EXPECT().
+			Regions(gomock.Any()).
+			Return([]service.Region{region}, nil)
+		mock.EXPECT().
+			Countries(gomock.Any()).
+			Return([]service.Country{}, nil).
+			Times(2)
+
+		for i := 0; i < 2; i++ {
+			// This should use the cache and not the mock the second time.
+			got, err := api.Regions(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := []service.Region{region}, got; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+
+		// Empty reference data isn't cached.
+		for i := 0; i < 2; i++ {
+			if _, err := api.Countries(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock)
+		)
+
+		mock.EXPECT().
+			BusinessTypes(gomock.Any()).
+			Return(nil, errors.New("something went wrong"))
+
+		_, err := api.BusinessTypes(context.Background())
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
 func TestCacheServiceEstablishmentsForAuthority(t *testing.T) {
 	t.Parallel()
 
@@ -75,10 +142,10 @@ func TestCacheServiceEstablishmentsForAuthority(t *testing.T) {
 		)
 
 		mock.EXPECT().
-			EstablishmentsForAuthority("0").
+			EstablishmentsForAuthority(gomock.Any(), "0").
 			Return([]service.Establishment{}, nil)
 
-		_, err := api.EstablishmentsForAuthority("0")
+		_, err := api.EstablishmentsForAuthority(context.Background(), "0")
 		if expected, actual := true, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
@@ -98,10 +165,10 @@ func TestCacheServiceEstablishmentsForAuthority(t *testing.T) {
 		)
 
 		mock.EXPECT().
-			EstablishmentsForAuthority("0").
+			EstablishmentsForAuthority(gomock.Any(), "0").
 			Return([]service.Establishment{est}, nil)
 
-		got, err := api.EstablishmentsForAuthority("0")
+		got, err := api.EstablishmentsForAuthority(context.Background(), "0")
 		if expected, actual := true, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
@@ -110,7 +177,7 @@ func TestCacheServiceEstablishmentsForAuthority(t *testing.T) {
 		}
 
 		// This should use the cache and not the mock.
-		got, err = api.EstablishmentsForAuthority("0")
+		got, err = api.EstablishmentsForAuthority(context.Background(), "0")
 		if expected, actual := true, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
@@ -137,14 +204,14 @@ func TestCacheServiceEstablishmentsForAuthority(t *testing.T) {
 		)
 
 		mock.EXPECT().
-			EstablishmentsForAuthority("0").
+			EstablishmentsForAuthority(gomock.Any(), "0").
 			Return([]service.Establishment{est0}, nil)
 
 		mock.EXPECT().
-			EstablishmentsForAuthority("1").
+			EstablishmentsForAuthority(gomock.Any(), "1").
 			Return([]service.Establishment{est1}, nil)
 
-		got, err := api.EstablishmentsForAuthority("0")
+		got, err := api.EstablishmentsForAuthority(context.Background(), "0")
 		if expected, actual := true, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
@@ -153,7 +220,7 @@ func TestCacheServiceEstablishmentsForAuthority(t *testing.T) {
 		}
 
 		// This should use the cache and not the mock.
-		got, err = api.EstablishmentsForAuthority("1")
+		got, err = api.EstablishmentsForAuthority(context.Background(), "1")
 		if expected, actual := true, err == nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
@@ -162,3 +229,603 @@ func TestCacheServiceEstablishmentsForAuthority(t *testing.T) {
 		}
 	})
 }
+
+func TestCacheServiceExpiry(t *testing.T) {
+	t.Parallel()
+
+	t.Run("authorities expired", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock, service.WithAuthoritiesTTL(time.Millisecond))
+			auth = service.Authority{
+				Name:    "Yorkshire",
+				LocalID: 123,
+			}
+		)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{auth}, nil).
+			Times(2)
+
+		_, err := api.Authorities(context.Background())
+		if expected, actual := true, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		// This should have expired and go back to the mock.
+		_, err = api.Authorities(context.Background())
+		if expected, actual := true, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("establishments not expired", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock, service.WithEstablishmentsTTL(time.Hour))
+			est  = service.Establishment{
+				Name:   "Bobs Burgers",
+				Rating: "3",
+			}
+		)
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est}, nil)
+
+		for i := 0; i < 2; i++ {
+			got, err := api.EstablishmentsForAuthority(context.Background(), "0")
+			if expected, actual := true, err == nil; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+			if expected, actual := est, got[0]; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("establishments expired", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock, service.WithEstablishmentsTTL(time.Millisecond))
+			est  = service.Establishment{
+				Name:   "Bobs Burgers",
+				Rating: "3",
+			}
+		)
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est}, nil).
+			Times(2)
+
+		_, err := api.EstablishmentsForAuthority(context.Background(), "0")
+		if expected, actual := true, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		// This should have expired and go back to the mock.
+		_, err = api.EstablishmentsForAuthority(context.Background(), "0")
+		if expected, actual := true, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestCacheServiceEviction(t *testing.T) {
+	t.Parallel()
+
+	est := service.Establishment{
+		Name:   "Bobs Burgers",
+		Rating: "3",
+	}
+
+	t.Run("max entries", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock, service.WithMaxEntries(2))
+		)
+
+		// "0" is requested twice, because it's the least recently used when
+		// "2" is added.
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est}, nil).
+			Times(2)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{est}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "2").
+			Return([]service.Establishment{est}, nil)
+
+		for _, id := range []string{"0", "1", "1", "2", "1", "0"} {
+			_, err := api.EstablishmentsForAuthority(context.Background(), id)
+			if expected, actual := true, err == nil; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock, service.WithMaxBytes(1))
+		)
+
+		// Nothing fits with in a single byte, so everything is requested.
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est}, nil).
+			Times(2)
+
+		for i := 0; i < 2; i++ {
+			_, err := api.EstablishmentsForAuthority(context.Background(), "0")
+			if expected, actual := true, err == nil; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+}
+
+func TestCacheServiceConcurrency(t *testing.T) {
+	t.Parallel()
+
+	est := service.Establishment{
+		Name:   "Bobs Burgers",
+		Rating: "3",
+	}
+
+	t.Run("same authority", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			started = make(chan struct{}, 1)
+			release = make(chan struct{})
+			mock    = NewMockService(ctrl)
+			api     = service.NewCache(hookService{mock, func(string) {
+				started <- struct{}{}
+				<-release
+			}})
+		)
+
+		// Only one request should make it to the underlying service.
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est}, nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				got, err := api.EstablishmentsForAuthority(context.Background(), "0")
+				if expected, actual := true, err == nil; expected != actual {
+					t.Errorf("expected: %v, actual: %v", expected, actual)
+				}
+				if expected, actual := 1, len(got); expected != actual {
+					t.Errorf("expected: %v, actual: %v", expected, actual)
+				}
+			}()
+		}
+
+		<-started
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+
+		wg.Wait()
+	})
+
+	t.Run("different authorities", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			requested = make(chan struct{})
+			mock      = NewMockService(ctrl)
+			api       = service.NewCache(hookService{mock, func(id string) {
+				switch id {
+				case "0":
+					// Block until the other authority has been requested,
+					// which can't happen if they're serialized.
+					select {
+					case <-requested:
+					case <-time.After(time.Second):
+						t.Errorf("expected authority 1 to be requested in parallel")
+					}
+				case "1":
+					close(requested)
+				}
+			}})
+		)
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{est}, nil)
+
+		var wg sync.WaitGroup
+		for _, id := range []string{"0", "1"} {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+
+				_, err := api.EstablishmentsForAuthority(context.Background(), id)
+				if expected, actual := true, err == nil; expected != actual {
+					t.Errorf("expected: %v, actual: %v", expected, actual)
+				}
+			}(id)
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("authorities during slow authority", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			started = make(chan struct{})
+			release = make(chan struct{})
+			mock    = NewMockService(ctrl)
+			api     = service.NewCache(hookService{mock, func(id string) {
+				if id == "0" {
+					close(started)
+					<-release
+				}
+			}})
+		)
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est}, nil)
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{}, nil)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			_, err := api.EstablishmentsForAuthority(context.Background(), "0")
+			if expected, actual := true, err == nil; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}()
+
+		<-started
+
+		_, err := api.Authorities(context.Background())
+		if expected, actual := true, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		close(release)
+		<-done
+	})
+
+	t.Run("cancelled waiting", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			started = make(chan struct{})
+			release = make(chan struct{})
+			mock    = NewMockService(ctrl)
+			api     = service.NewCache(hookService{mock, func(string) {
+				close(started)
+				<-release
+			}})
+		)
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est}, nil)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			_, err := api.EstablishmentsForAuthority(context.Background(), "0")
+			if expected, actual := true, err == nil; expected != actual {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}()
+
+		<-started
+
+		// The duplicate request should give up waiting when it's cancelled.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := api.EstablishmentsForAuthority(ctx, "0")
+		if expected, actual := context.Canceled, err; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		close(release)
+		<-done
+	})
+}
+
+func TestCacheServiceEstablishment(t *testing.T) {
+	t.Parallel()
+
+	est := service.Establishment{
+		ID:     123,
+		Name:   "Bobs burgers",
+		Rating: "5",
+	}
+
+	t.Run("repeated", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock)
+		)
+
+		mock.EXPECT().
+			Establishment(gomock.Any(), 123).
+			Return(est, nil)
+
+		// The second request should use the cache and not the mock.
+		for i := 0; i < 2; i++ {
+			got, err := api.Establishment(context.Background(), 123)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := est, got; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("separate from authority", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock)
+		)
+
+		// The establishment id shouldn't collide with a local id.
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "123").
+			Return([]service.Establishment{est, est}, nil)
+		mock.EXPECT().
+			Establishment(gomock.Any(), 123).
+			Return(est, nil)
+
+		if _, err := api.EstablishmentsForAuthority(context.Background(), "123"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.Establishment(context.Background(), 123); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock)
+		)
+
+		// Errors aren't cached, so every request goes to the mock.
+		mock.EXPECT().
+			Establishment(gomock.Any(), 123).
+			Return(service.Establishment{}, service.ErrNotFound).
+			Times(2)
+
+		for i := 0; i < 2; i++ {
+			if _, err := api.Establishment(context.Background(), 123); err != service.ErrNotFound {
+				t.Errorf("expected: %v, actual: %v", service.ErrNotFound, err)
+			}
+		}
+	})
+}
+
+// hookService calls the hook before delegating to the underlying service, so
+// that requests can be blocked with out holding onto the mock controller.
+type hookService struct {
+	service.Service
+	hook func(string)
+}
+
+func (s hookService) Authorities(ctx context.Context) ([]service.Authority, error) {
+	s.hook("")
+	return s.Service.Authorities(ctx)
+}
+
+func (s hookService) EstablishmentsForAuthority(ctx context.Context, localID string) ([]service.Establishment, error) {
+	s.hook(localID)
+	return s.Service.EstablishmentsForAuthority(ctx, localID)
+}
+
+func TestCacheServiceStaleWhileRevalidate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("establishments", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			refreshed = make(chan struct{})
+			mock      = NewMockService(ctrl)
+			api       = service.NewCache(mock,
+				service.WithEstablishmentsTTL(time.Millisecond),
+				service.WithStaleWhileRevalidate(time.Hour),
+			)
+			est0 = service.Establishment{
+				Name:   "Bobs Burgers",
+				Rating: "3",
+			}
+			est1 = service.Establishment{
+				Name:   "Bobs Burgers",
+				Rating: "5",
+			}
+		)
+
+		gomock.InOrder(
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "0").
+				Return([]service.Establishment{est0}, nil),
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "0").
+				Do(func(context.Context, string) { close(refreshed) }).
+				Return([]service.Establishment{est1}, nil),
+		)
+
+		ctx, freshness := service.WithFreshness(context.Background())
+		if _, err := api.EstablishmentsForAuthority(ctx, "0"); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := service.FreshnessMiss, freshness.Status; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		// This should be served the stale value, whilst refreshing.
+		ctx, freshness = service.WithFreshness(context.Background())
+		got, err := api.EstablishmentsForAuthority(ctx, "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := est0, got[0]; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := service.FreshnessStale, freshness.Status; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := true, freshness.Age > 0; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		<-refreshed
+
+		// Eventually the refreshed value should be served.
+		for deadline := time.Now().Add(time.Second); ; {
+			got, err = api.EstablishmentsForAuthority(context.Background(), "0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.DeepEqual(est1, got[0]) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected: %v, actual: %v", est1, got[0])
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("authorities", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			refreshed = make(chan struct{})
+			mock      = NewMockService(ctrl)
+			api       = service.NewCache(mock,
+				service.WithAuthoritiesTTL(time.Millisecond),
+				service.WithStaleWhileRevalidate(time.Hour),
+			)
+			auth = service.Authority{
+				Name:    "Yorkshire",
+				LocalID: 123,
+			}
+		)
+
+		gomock.InOrder(
+			mock.EXPECT().
+				Authorities(gomock.Any()).
+				Return([]service.Authority{auth}, nil),
+			mock.EXPECT().
+				Authorities(gomock.Any()).
+				Do(func(context.Context) { close(refreshed) }).
+				Return([]service.Authority{auth}, nil),
+		)
+
+		if _, err := api.Authorities(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		ctx, freshness := service.WithFreshness(context.Background())
+		if _, err := api.Authorities(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := service.FreshnessStale, freshness.Status; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		<-refreshed
+	})
+
+	t.Run("outside stale window", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = service.NewCache(mock,
+				service.WithEstablishmentsTTL(time.Millisecond),
+				service.WithStaleWhileRevalidate(time.Millisecond),
+			)
+			est = service.Establishment{
+				Name:   "Bobs Burgers",
+				Rating: "3",
+			}
+		)
+
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est}, nil).
+			Times(2)
+
+		if _, err := api.EstablishmentsForAuthority(context.Background(), "0"); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		ctx, freshness := service.WithFreshness(context.Background())
+		if _, err := api.EstablishmentsForAuthority(ctx, "0"); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := service.FreshnessMiss, freshness.Status; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
@@ -0,0 +1,448 @@
+package mock_service
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+)
+
+func TestDiskServiceAuthorities(t *testing.T) {
+	t.Parallel()
+
+	auth := service.Authority{
+		Name:               "Yorkshire",
+		LocalID:            123,
+		EstablishmentCount: 10,
+	}
+
+	t.Run("survives restart", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		mock := NewMockService(ctrl)
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{auth}, nil)
+
+		api := newDisk(t, mock, dir, 0)
+		if _, err := api.Authorities(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// This should read from the disk and not the mock.
+		api = newDisk(t, mock, dir, 0)
+		got, err := api.Authorities(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []service.Authority{auth}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = newDisk(t, mock, dir, time.Millisecond)
+		)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{auth}, nil).
+			Times(2)
+
+		for i := 0; i < 2; i++ {
+			if _, err := api.Authorities(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("expired fallback", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = newDisk(t, mock, dir, time.Millisecond)
+		)
+
+		gomock.InOrder(
+			mock.EXPECT().
+				Authorities(gomock.Any()).
+				Return([]service.Authority{auth}, nil),
+			mock.EXPECT().
+				Authorities(gomock.Any()).
+				Return(nil, errors.New("something went wrong")),
+		)
+
+		if _, err := api.Authorities(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		// The old record should be used when the underlying service fails.
+		got, err := api.Authorities(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []service.Authority{auth}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = newDisk(t, mock, dir, 0)
+		)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return(nil, errors.New("something went wrong"))
+
+		_, err := api.Authorities(context.Background())
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestDiskServiceEstablishmentsForAuthority(t *testing.T) {
+	t.Parallel()
+
+	est0 := service.Establishment{
+		Name:   "Bobs Burgers",
+		Rating: "3",
+	}
+	est1 := service.Establishment{
+		Name:   "Petes Pizza",
+		Rating: "4",
+	}
+
+	t.Run("survives restart", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		mock := NewMockService(ctrl)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est0}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "../1").
+			Return([]service.Establishment{est1}, nil)
+
+		api := newDisk(t, mock, dir, 0)
+		for _, id := range []string{"0", "../1"} {
+			if _, err := api.EstablishmentsForAuthority(context.Background(), id); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// This should read from the disk and not the mock.
+		api = newDisk(t, mock, dir, 0)
+		for id, est := range map[string]service.Establishment{"0": est0, "../1": est1} {
+			got, err := api.EstablishmentsForAuthority(context.Background(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := []service.Establishment{est}, got; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("empty not persisted", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		var (
+			mock = NewMockService(ctrl)
+			api  = newDisk(t, mock, dir, 0)
+		)
+
+		gomock.InOrder(
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "0").
+				Return([]service.Establishment{}, nil),
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), "0").
+				Return([]service.Establishment{est0}, nil),
+		)
+
+		// The empty result shouldn't be served again, instead the next request
+		// should go to the mock.
+		for _, want := range [][]service.Establishment{
+			[]service.Establishment{},
+			[]service.Establishment{est0},
+		} {
+			got, err := api.EstablishmentsForAuthority(context.Background(), "0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		mock := NewMockService(ctrl)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est0}, nil).
+			Times(2)
+
+		api := newDisk(t, mock, dir, 0)
+		if _, err := api.EstablishmentsForAuthority(context.Background(), "0"); err != nil {
+			t.Fatal(err)
+		}
+
+		corrupt(t, dir, func(b []byte) []byte {
+			b[len(b)-2] = 'X'
+			return b
+		})
+
+		// The corrupt record should be discarded and the mock used.
+		api = newDisk(t, mock, dir, 0)
+		got, err := api.EstablishmentsForAuthority(context.Background(), "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []service.Establishment{est0}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("version", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		mock := NewMockService(ctrl)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est0}, nil).
+			Times(2)
+
+		api := newDisk(t, mock, dir, 0)
+		if _, err := api.EstablishmentsForAuthority(context.Background(), "0"); err != nil {
+			t.Fatal(err)
+		}
+
+		corrupt(t, dir, func(b []byte) []byte {
+			return append([]byte("hygiene/0"), b[len("hygiene/1"):]...)
+		})
+
+		// The old version should be discarded and the mock used.
+		api = newDisk(t, mock, dir, 0)
+		if _, err := api.EstablishmentsForAuthority(context.Background(), "0"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("unfinished write", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		mock := NewMockService(ctrl)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est0}, nil)
+
+		api := newDisk(t, mock, dir, 0)
+		if _, err := api.EstablishmentsForAuthority(context.Background(), "0"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Leave a temporary file behind, as if the write crashed before the
+		// rename. Other files in the directory should be left alone.
+		for _, name := range []string{"establishments-0-123.tmp", "notes.txt"} {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("hygiene/"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The temporary file should be removed, but the record kept.
+		api = newDisk(t, mock, dir, 0)
+		if _, err := api.EstablishmentsForAuthority(context.Background(), "0"); err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var exts []string
+		for _, file := range files {
+			exts = append(exts, filepath.Ext(file))
+		}
+		sort.Strings(exts)
+		if expected, actual := []string{".rec", ".txt"}, exts; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("stacked with cache", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		mock := NewMockService(ctrl)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return([]service.Establishment{est0}, nil)
+
+		for i := 0; i < 2; i++ {
+			api := service.NewCache(newDisk(t, mock, dir, 0))
+			got, err := api.EstablishmentsForAuthority(context.Background(), "0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := []service.Establishment{est0}, got; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+}
+
+func TestDiskServiceEstablishment(t *testing.T) {
+	t.Parallel()
+
+	est := service.Establishment{
+		ID:     123,
+		Name:   "Bobs burgers",
+		Rating: "5",
+	}
+
+	t.Run("survives restart", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		mock := NewMockService(ctrl)
+		mock.EXPECT().
+			Establishment(gomock.Any(), 123).
+			Return(est, nil)
+
+		api := newDisk(t, mock, dir, 0)
+		if _, err := api.Establishment(context.Background(), 123); err != nil {
+			t.Fatal(err)
+		}
+
+		// This should read from the disk and not the mock.
+		api = newDisk(t, mock, dir, 0)
+		got, err := api.Establishment(context.Background(), 123)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := est, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+
+		mock := NewMockService(ctrl)
+		mock.EXPECT().
+			Establishment(gomock.Any(), 123).
+			Return(service.Establishment{}, service.ErrNotFound)
+
+		api := newDisk(t, mock, dir, 0)
+		if _, err := api.Establishment(context.Background(), 123); err != service.ErrNotFound {
+			t.Errorf("expected: %v, actual: %v", service.ErrNotFound, err)
+		}
+	})
+}
+
+func newDisk(t *testing.T, s service.Service, dir string, ttl time.Duration) service.Service {
+	api, err := service.NewDisk(s, dir, ttl, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "hygiene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// corrupt modifies every record with in the directory.
+func corrupt(t *testing.T, dir string, fn func([]byte) []byte) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.rec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected records")
+	}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, fn(b), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
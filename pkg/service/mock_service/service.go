@@ -4,6 +4,8 @@
 package mock_service
 
 import (
+	context "context"
+
 	service "github.com/SimonRichardson/foodhygiene/pkg/service"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -32,27 +34,105 @@ func (_m *MockService) EXPECT() *MockServiceMockRecorder {
 }
 
 // Authorities mocks base method
-func (_m *MockService) Authorities() ([]service.Authority, error) {
-	ret := _m.ctrl.Call(_m, "Authorities")
+func (_m *MockService) Authorities(_param0 context.Context) ([]service.Authority, error) {
+	ret := _m.ctrl.Call(_m, "Authorities", _param0)
 	ret0, _ := ret[0].([]service.Authority)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Authorities indicates an expected call of Authorities
-func (_mr *MockServiceMockRecorder) Authorities() *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Authorities")
+func (_mr *MockServiceMockRecorder) Authorities(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Authorities", arg0)
+}
+
+// BusinessTypes mocks base method
+func (_m *MockService) BusinessTypes(_param0 context.Context) ([]service.BusinessType, error) {
+	ret := _m.ctrl.Call(_m, "BusinessTypes", _param0)
+	ret0, _ := ret[0].([]service.BusinessType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BusinessTypes indicates an expected call of BusinessTypes
+func (_mr *MockServiceMockRecorder) BusinessTypes(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "BusinessTypes", arg0)
+}
+
+// Countries mocks base method
+func (_m *MockService) Countries(_param0 context.Context) ([]service.Country, error) {
+	ret := _m.ctrl.Call(_m, "Countries", _param0)
+	ret0, _ := ret[0].([]service.Country)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Countries indicates an expected call of Countries
+func (_mr *MockServiceMockRecorder) Countries(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Countries", arg0)
+}
+
+// Establishment mocks base method
+func (_m *MockService) Establishment(_param0 context.Context, _param1 int) (service.Establishment, error) {
+	ret := _m.ctrl.Call(_m, "Establishment", _param0, _param1)
+	ret0, _ := ret[0].(service.Establishment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Establishment indicates an expected call of Establishment
+func (_mr *MockServiceMockRecorder) Establishment(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Establishment", arg0, arg1)
 }
 
 // EstablishmentsForAuthority mocks base method
-func (_m *MockService) EstablishmentsForAuthority(_param0 string) ([]service.Establishment, error) {
-	ret := _m.ctrl.Call(_m, "EstablishmentsForAuthority", _param0)
+func (_m *MockService) EstablishmentsForAuthority(_param0 context.Context, _param1 string) ([]service.Establishment, error) {
+	ret := _m.ctrl.Call(_m, "EstablishmentsForAuthority", _param0, _param1)
 	ret0, _ := ret[0].([]service.Establishment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // EstablishmentsForAuthority indicates an expected call of EstablishmentsForAuthority
-func (_mr *MockServiceMockRecorder) EstablishmentsForAuthority(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "EstablishmentsForAuthority", arg0)
+func (_mr *MockServiceMockRecorder) EstablishmentsForAuthority(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "EstablishmentsForAuthority", arg0, arg1)
+}
+
+// Ratings mocks base method
+func (_m *MockService) Ratings(_param0 context.Context) ([]service.Rating, error) {
+	ret := _m.ctrl.Call(_m, "Ratings", _param0)
+	ret0, _ := ret[0].([]service.Rating)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Ratings indicates an expected call of Ratings
+func (_mr *MockServiceMockRecorder) Ratings(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Ratings", arg0)
+}
+
+// Regions mocks base method
+func (_m *MockService) Regions(_param0 context.Context) ([]service.Region, error) {
+	ret := _m.ctrl.Call(_m, "Regions", _param0)
+	ret0, _ := ret[0].([]service.Region)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Regions indicates an expected call of Regions
+func (_mr *MockServiceMockRecorder) Regions(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Regions", arg0)
+}
+
+// SchemeTypes mocks base method
+func (_m *MockService) SchemeTypes(_param0 context.Context) ([]service.SchemeType, error) {
+	ret := _m.ctrl.Call(_m, "SchemeTypes", _param0)
+	ret0, _ := ret[0].([]service.SchemeType)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SchemeTypes indicates an expected call of SchemeTypes
+func (_mr *MockServiceMockRecorder) SchemeTypes(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SchemeTypes", arg0)
 }
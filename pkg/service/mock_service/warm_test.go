@@ -0,0 +1,140 @@
+package mock_service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/SimonRichardson/foodhygiene/pkg/service"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+)
+
+func TestWarm(t *testing.T) {
+	t.Parallel()
+
+	t.Run("every authority", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mock        = NewMockService(ctrl)
+			api         = service.NewCache(mock)
+			authorities = make([]service.Authority, 100)
+		)
+		for k := range authorities {
+			authorities[k] = service.Authority{
+				Name:    "Yorkshire",
+				LocalID: k,
+			}
+		}
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return(authorities, nil)
+		for _, v := range authorities {
+			mock.EXPECT().
+				EstablishmentsForAuthority(gomock.Any(), strconv.Itoa(v.LocalID)).
+				Return([]service.Establishment{}, nil)
+		}
+
+		if err := service.Warm(context.Background(), api, 4, log.NewNopLogger()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("bounded workers", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			mutex       sync.Mutex
+			inflight    int
+			maxInflight int
+			workers     = 3
+			mock        = NewMockService(ctrl)
+			authorities = make([]service.Authority, 20)
+		)
+		for k := range authorities {
+			authorities[k] = service.Authority{
+				Name:    "Yorkshire",
+				LocalID: k,
+			}
+		}
+
+		api := hookService{mock, func(id string) {
+			if id == "" {
+				return
+			}
+			mutex.Lock()
+			inflight++
+			if inflight > maxInflight {
+				maxInflight = inflight
+			}
+			mutex.Unlock()
+		}}
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return(authorities, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), gomock.Any()).
+			Do(func(context.Context, string) {
+				mutex.Lock()
+				inflight--
+				mutex.Unlock()
+			}).
+			Return([]service.Establishment{}, nil).
+			Times(len(authorities))
+
+		if err := service.Warm(context.Background(), api, workers, log.NewNopLogger()); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := true, maxInflight <= workers; expected != actual {
+			t.Errorf("expected: %v, actual: %v (%d)", expected, actual, maxInflight)
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mock := NewMockService(ctrl)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return([]service.Authority{
+				service.Authority{LocalID: 0},
+				service.Authority{LocalID: 1},
+			}, nil)
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "0").
+			Return(nil, errors.New("something went wrong"))
+		mock.EXPECT().
+			EstablishmentsForAuthority(gomock.Any(), "1").
+			Return([]service.Establishment{}, nil)
+
+		err := service.Warm(context.Background(), mock, 2, log.NewNopLogger())
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("authorities error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mock := NewMockService(ctrl)
+
+		mock.EXPECT().
+			Authorities(gomock.Any()).
+			Return(nil, errors.New("something went wrong"))
+
+		err := service.Warm(context.Background(), mock, 2, log.NewNopLogger())
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
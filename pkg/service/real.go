@@ -1,14 +1,20 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 )
 
@@ -20,19 +26,74 @@ const (
 	defaultKeepAlive     = 30 * time.Second
 )
 
+// These are the defaults for requesting establishments a page at a time.
+const (
+	defaultPageSize        = 500
+	defaultPageConcurrency = 4
+)
+
 // realService defines a structure for requesting entities from the ratings gov site
 type realService struct {
-	base    string
-	version int
-	client  *http.Client
-	logger  log.Logger
+	base            string
+	version         int
+	client          *http.Client
+	retry           retryPolicy
+	pageSize        int
+	pageConcurrency int
+	limiter         *limiter
+	logger          log.Logger
+}
+
+// Option defines a option for configuring the real service.
+type Option func(*realService)
+
+// WithRetries sets how many times a failed request is retried. A request is
+// only retried if there was a transport error or the API states that it's a
+// temporary failure (see retryable).
+func WithRetries(n int) Option {
+	return func(s *realService) {
+		s.retry.retries = n
+	}
+}
+
+// WithBackoff sets the base and max durations of the exponential backoff used
+// between retries. The max duration also bounds how long a "Retry-After" from
+// the API is honoured for, anything longer and the request is failed.
+func WithBackoff(base, max time.Duration) Option {
+	return func(s *realService) {
+		s.retry.base = base
+		s.retry.max = max
+	}
+}
+
+// WithPaging sets the number of establishments requested per page and how many
+// pages are requested concurrently. A zero page size disables paging and every
+// establishment for a Authority is requested at once.
+func WithPaging(size, concurrency int) Option {
+	return func(s *realService) {
+		s.pageSize = size
+		s.pageConcurrency = concurrency
+	}
+}
+
+// WithRateLimit limits the requests sent to the API to rate per second,
+// allowing bursts of up to burst requests. Every HTTP request counts, so a
+// single call for a large Authority can take many tokens, one for each page and
+// each retry. A zero rate disables the limit.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(s *realService) {
+		s.limiter = nil
+		if rate > 0 {
+			s.limiter = newLimiter(rate, burst)
+		}
+	}
 }
 
 // New creates a Service from a base url and the API version to use for the
 // underlying service.
 // Note: if a version is not supplied with the request then calls to the API
 // endpoints will return no data.
-func New(base string, version int, logger log.Logger) Service {
+func New(base string, version int, logger log.Logger, options ...Option) Service {
 	// Create a new http client, so we can handle timeouts in a more granular
 	// manor.
 	client := &http.Client{
@@ -49,75 +110,320 @@ func New(base string, version int, logger log.Logger) Service {
 		},
 	}
 	// Return the service.
-	return &realService{
+	s := &realService{
 		base:    base,
 		version: version,
 		client:  client,
-		logger:  logger,
+		retry: retryPolicy{
+			base: defaultBackoff,
+			max:  defaultMaxBackoff,
+		},
+		pageSize:        defaultPageSize,
+		pageConcurrency: defaultPageConcurrency,
+		logger:          logger,
+	}
+	for _, option := range options {
+		option(s)
 	}
+	if s.pageConcurrency < 1 {
+		s.pageConcurrency = 1
+	}
+	return s
 }
 
 // Authorities returns a series of Authorities from the underlying API or it
 // returns an error if it was not able to request or parse the result.
-func (s *realService) Authorities() ([]Authority, error) {
-	req, err := s.newRequest("/Authorities")
-	if err != nil {
+func (s *realService) Authorities(ctx context.Context) ([]Authority, error) {
+	var res Authorities
+	if err := s.get(ctx, "/Authorities", &res); err != nil {
 		return nil, err
 	}
+	return res.Authorities, nil
+}
 
-	resp, err := s.client.Do(req)
-	if err != nil {
+// Regions returns a series of Regions from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *realService) Regions(ctx context.Context) ([]Region, error) {
+	var res Regions
+	if err := s.get(ctx, "/Regions", &res); err != nil {
 		return nil, err
 	}
+	return res.Regions, nil
+}
 
-	defer resp.Body.Close()
+// Countries returns a series of Countries from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *realService) Countries(ctx context.Context) ([]Country, error) {
+	var res Countries
+	if err := s.get(ctx, "/Countries", &res); err != nil {
+		return nil, err
+	}
+	return res.Countries, nil
+}
 
-	if code := resp.StatusCode; code < 200 || code >= 300 {
-		return nil, errors.Errorf("invalid request (status code: %d)", code)
+// BusinessTypes returns a series of BusinessTypes from the underlying API or
+// it returns an error if it was not able to request or parse the result.
+func (s *realService) BusinessTypes(ctx context.Context) ([]BusinessType, error) {
+	var res BusinessTypes
+	if err := s.get(ctx, "/BusinessTypes", &res); err != nil {
+		return nil, err
 	}
+	return res.BusinessTypes, nil
+}
 
-	// Parse out the errors
-	var res Authorities
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+// SchemeTypes returns a series of SchemeTypes from the underlying API or it
+// returns an error if it was not able to request or parse the result.
+func (s *realService) SchemeTypes(ctx context.Context) ([]SchemeType, error) {
+	var res SchemeTypes
+	if err := s.get(ctx, "/SchemeTypes", &res); err != nil {
 		return nil, err
 	}
+	return res.SchemeTypes, nil
+}
 
-	return res.Authorities, nil
+// Ratings returns a series of Ratings from the underlying API or it returns an
+// error if it was not able to request or parse the result.
+func (s *realService) Ratings(ctx context.Context) ([]Rating, error) {
+	var res Ratings
+	if err := s.get(ctx, "/Ratings", &res); err != nil {
+		return nil, err
+	}
+	return res.Ratings, nil
 }
 
 // EstablishmentsForAuthority returns a series of Establishments from the
 // underlying API or it returns an error if it was not able to request or
 // parse the result. The Establishments service API takes a Authority
 // LocalID to select the correct set of establishments for that Authority.
-func (s *realService) EstablishmentsForAuthority(id string) ([]Establishment, error) {
-	req, err := s.newRequest(fmt.Sprintf("/Establishments?localAuthorityId=%s&pageSize=0", id))
+// The establishments are requested a page at a time, with the pages after the
+// first requested concurrently, so that large authorities don't time out.
+func (s *realService) EstablishmentsForAuthority(ctx context.Context, id string) ([]Establishment, error) {
+	var (
+		mutex   sync.Mutex
+		results = make(map[int][]Establishment)
+	)
+	pages, err := s.eachEstablishment(ctx, id, func(page int, e Establishment) error {
+		mutex.Lock()
+		results[page] = append(results[page], e)
+		mutex.Unlock()
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := s.client.Do(req)
+	// Reassemble the pages in order.
+	n := 0
+	for _, v := range results {
+		n += len(v)
+	}
+	establishments := make([]Establishment, 0, n)
+	for page := 1; page <= pages; page++ {
+		establishments = append(establishments, results[page]...)
+	}
+	return establishments, nil
+}
+
+// Establishment returns a single Establishment by it's FHRSID from the
+// underlying API or it returns an error if it was not able to request or parse
+// the result.
+func (s *realService) Establishment(ctx context.Context, id int) (Establishment, error) {
+	resp, err := s.do(ctx, fmt.Sprintf("/Establishments/%d", id))
 	if err != nil {
-		return nil, err
+		return Establishment{}, err
 	}
 
 	defer resp.Body.Close()
 
-	if code := resp.StatusCode; code < 200 || code >= 300 {
-		return nil, errors.Errorf("invalid request (status code: %d)", code)
+	if code := resp.StatusCode; code == http.StatusNotFound {
+		return Establishment{}, ErrNotFound
+	} else if code < 200 || code >= 300 {
+		return Establishment{}, &StatusError{Code: code}
 	}
 
-	// Parse out the errors
-	var res Establishments
+	var res Establishment
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
+		return Establishment{}, err
 	}
 
-	return res.Establishments, nil
+	return res, nil
+}
+
+// StreamEstablishmentsForAuthority calls fn for every Establishment of the
+// Authority as it's decoded from the underlying API, so the establishments are
+// never held in memory all at once. The pages are requested concurrently, so
+// the order of the establishments isn't guaranteed, but fn is never called
+// concurrently. If fn returns an error then the stream stops and the error is
+// returned.
+func (s *realService) StreamEstablishmentsForAuthority(ctx context.Context, id string, fn func(Establishment) error) error {
+	var mutex sync.Mutex
+	_, err := s.eachEstablishment(ctx, id, func(page int, e Establishment) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return fn(e)
+	})
+	return err
+}
+
+// eachEstablishment requests every page of establishments for a Authority,
+// calling fn for every establishment along with the page it was found on. The
+// pages after the first are requested concurrently, so fn can be called
+// concurrently. Every page, and every retry of a page, goes through do so it
+// takes its own token from the rate limit; the concurrency only changes how
+// many pages are waiting at once, not the rate. It returns the number of pages
+// requested.
+func (s *realService) eachEstablishment(ctx context.Context, id string, fn func(int, Establishment) error) (int, error) {
+	meta, err := s.establishmentsPage(ctx, id, 1, func(e Establishment) error {
+		return fn(1, e)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	pages := meta.TotalPages
+	if s.pageSize <= 0 || pages <= 1 {
+		return 1, nil
+	}
+
+	// Stop requesting pages as soon as one of them fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg        sync.WaitGroup
+		once      sync.Once
+		pageErr   error
+		semaphore = make(chan struct{}, s.pageConcurrency)
+	)
+
+loop:
+	for page := 2; page <= pages; page++ {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+
+		wg.Add(1)
+		go func(page int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			if _, err := s.establishmentsPage(ctx, id, page, func(e Establishment) error {
+				return fn(page, e)
+			}); err != nil {
+				once.Do(func() {
+					pageErr = errors.Wrapf(err, "error requesting page %d of %d", page, pages)
+					cancel()
+				})
+			}
+		}(page)
+	}
+
+	wg.Wait()
+
+	if pageErr != nil {
+		return 0, pageErr
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return pages, nil
+}
+
+// establishmentsPage requests a single page of establishments for a
+// Authority, calling fn for every establishment as it's decoded. If paging is
+// disabled then every establishment is requested in one page.
+func (s *realService) establishmentsPage(ctx context.Context, id string, page int, fn func(Establishment) error) (Meta, error) {
+	path := fmt.Sprintf("/Establishments?localAuthorityId=%s&pageSize=0", url.QueryEscape(id))
+	if s.pageSize > 0 {
+		path = fmt.Sprintf("/Establishments?localAuthorityId=%s&pageNumber=%d&pageSize=%d", url.QueryEscape(id), page, s.pageSize)
+	}
+
+	resp, err := s.do(ctx, path)
+	if err != nil {
+		return Meta{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code < 200 || code >= 300 {
+		return Meta{}, &StatusError{Code: code}
+	}
+
+	return decodeEstablishments(resp.Body, fn)
+}
+
+// get requests the url and decodes the JSON payload into v.
+func (s *realService) get(ctx context.Context, url string, v interface{}) error {
+	resp, err := s.do(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if code := resp.StatusCode; code < 200 || code >= 300 {
+		return &StatusError{Code: code}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// do sends a request to the API, retrying with a backoff if the request fails
+// temporarily. Every attempt waits on the rate limit, if there is one. The
+// caller is responsible for closing the body of the response.
+func (s *realService) do(ctx context.Context, url string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if s.limiter != nil {
+			if err := s.limiter.wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := s.newRequest(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := s.client.Do(req)
+		if err == nil && !retryable(resp.StatusCode) {
+			return resp, nil
+		}
+		// Don't retry if the caller has gone away.
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+
+		wait, ok := s.retry.next(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			// Drain the body, so that the connection can be reused.
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		level.Debug(s.logger).Log("url", url, "attempt", attempt+1, "wait", wait.String(), "err", retryReason(resp, err))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
 }
 
 // newRequest makes sure that every request we send to the service has the
-// valid headers.
-func (s *realService) newRequest(url string) (*http.Request, error) {
+// valid headers. The request is bound to the context, so that if the context is
+// cancelled or the deadline is exceeded, the request is abandoned.
+func (s *realService) newRequest(ctx context.Context, url string) (*http.Request, error) {
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s", s.base, url), nil)
 	if err != nil {
 		return nil, err
@@ -127,5 +433,5 @@ func (s *realService) newRequest(url string) (*http.Request, error) {
 	req.Header.Set(serviceAPIVersion, strconv.Itoa(s.version))
 	req.Header.Set(serviceContentType, contentType)
 
-	return req, err
+	return req.WithContext(ctx), err
 }
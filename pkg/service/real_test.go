@@ -1,11 +1,16 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 )
@@ -32,7 +37,7 @@ func TestRealServiceAuthorities(t *testing.T) {
 			}
 		})
 
-		got, err := service.Authorities()
+		got, err := service.Authorities(context.Background())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -68,7 +73,7 @@ func TestRealServiceAuthorities(t *testing.T) {
 			}
 		})
 
-		got, err := service.Authorities()
+		got, err := service.Authorities(context.Background())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -93,11 +98,37 @@ func TestRealServiceAuthorities(t *testing.T) {
 			w.WriteHeader(http.StatusNotFound)
 		})
 
-		_, err := service.Authorities()
+		_, err := service.Authorities(context.Background())
 		if expected, actual := true, err != nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
 	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger())
+			done    = make(chan struct{})
+		)
+		defer server.Close()
+		defer close(done)
+
+		api.HandleFunc("/Authorities", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := service.Authorities(ctx)
+		if expected, actual := true, err != nil && strings.Contains(err.Error(), context.DeadlineExceeded.Error()); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
 }
 
 func TestRealServiceEstablishmentsForAuthority(t *testing.T) {
@@ -122,7 +153,7 @@ func TestRealServiceEstablishmentsForAuthority(t *testing.T) {
 			}
 		})
 
-		got, err := service.EstablishmentsForAuthority("0")
+		got, err := service.EstablishmentsForAuthority(context.Background(), "0")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -158,7 +189,7 @@ func TestRealServiceEstablishmentsForAuthority(t *testing.T) {
 			}
 		})
 
-		got, err := service.EstablishmentsForAuthority("0")
+		got, err := service.EstablishmentsForAuthority(context.Background(), "0")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -183,9 +214,743 @@ func TestRealServiceEstablishmentsForAuthority(t *testing.T) {
 			w.WriteHeader(http.StatusNotFound)
 		})
 
-		_, err := service.EstablishmentsForAuthority("0")
+		_, err := service.EstablishmentsForAuthority(context.Background(), "0")
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger())
+			done    = make(chan struct{})
+		)
+		defer server.Close()
+		defer close(done)
+
+		api.HandleFunc("/Establishments", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := service.EstablishmentsForAuthority(ctx, "0")
+		if expected, actual := true, err != nil && strings.Contains(err.Error(), context.DeadlineExceeded.Error()); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestRealServiceEstablishment(t *testing.T) {
+	t.Parallel()
+
+	t.Run("one", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger())
+		)
+		defer server.Close()
+
+		est := Establishment{
+			ID:     123,
+			Name:   "Bobs burgers",
+			Rating: "5",
+		}
+
+		api.HandleFunc("/Establishments/123", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+
+			if err := json.NewEncoder(w).Encode(est); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		got, err := service.Establishment(context.Background(), 123)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := est, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger())
+		)
+		defer server.Close()
+
+		_, err := service.Establishment(context.Background(), 123)
+		if expected, actual := ErrNotFound, err; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger())
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Establishments/123", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		})
+
+		_, err := service.Establishment(context.Background(), 123)
+		if expected, actual := true, err != nil && err != ErrNotFound; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestRealServiceReferences(t *testing.T) {
+	t.Parallel()
+
+	t.Run("regions", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger())
+		)
+		defer server.Close()
+
+		region := Region{
+			ID:   1,
+			Name: "Yorkshire and Humberside",
+			Code: "YH",
+		}
+
+		api.HandleFunc("/Regions", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+
+			res := Regions{
+				Regions: []Region{
+					region,
+				},
+			}
+			if err := json.NewEncoder(w).Encode(res); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		got, err := service.Regions(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := []Region{region}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("business types", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger())
+		)
+		defer server.Close()
+
+		api.HandleFunc("/BusinessTypes", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"businessTypes":[{"BusinessTypeId":1,"BusinessTypeName":"Restaurant/Cafe/Canteen"}]}`))
+		})
+
+		got, err := service.BusinessTypes(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []BusinessType{
+			BusinessType{
+				ID:   1,
+				Name: "Restaurant/Cafe/Canteen",
+			},
+		}
+		if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger())
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Ratings", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		})
+
+		_, err := service.Ratings(context.Background())
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestRealServiceRetry(t *testing.T) {
+	t.Parallel()
+
+	// failing returns a handler that fails n times with the status code before
+	// succeeding, counting the number of attempts made.
+	failing := func(n, code int, attempts *int32) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if int(atomic.AddInt32(attempts, 1)) <= n {
+				w.WriteHeader(code)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(Authorities{
+				Authorities: []Authority{},
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("success after failures", func(t *testing.T) {
+		var (
+			attempts int32
+			api      = http.NewServeMux()
+			server   = httptest.NewServer(api)
+			service  = New(server.URL, 2, log.NewNopLogger(),
+				WithRetries(3),
+				WithBackoff(time.Millisecond, 10*time.Millisecond),
+			)
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Authorities", failing(3, http.StatusBadGateway, &attempts))
+
+		if _, err := service.Authorities(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := int32(4), atomic.LoadInt32(&attempts); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("too many failures", func(t *testing.T) {
+		var (
+			attempts int32
+			api      = http.NewServeMux()
+			server   = httptest.NewServer(api)
+			service  = New(server.URL, 2, log.NewNopLogger(),
+				WithRetries(2),
+				WithBackoff(time.Millisecond, 10*time.Millisecond),
+			)
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Establishments", failing(3, http.StatusInternalServerError, &attempts))
+
+		_, err := service.EstablishmentsForAuthority(context.Background(), "0")
 		if expected, actual := true, err != nil; expected != actual {
 			t.Errorf("expected: %v, actual: %v", expected, actual)
 		}
+		if expected, actual := int32(3), atomic.LoadInt32(&attempts); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
 	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		var (
+			attempts int32
+			api      = http.NewServeMux()
+			server   = httptest.NewServer(api)
+			service  = New(server.URL, 2, log.NewNopLogger(),
+				WithRetries(3),
+				WithBackoff(time.Millisecond, 10*time.Millisecond),
+			)
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Authorities", failing(1, http.StatusNotFound, &attempts))
+
+		_, err := service.Authorities(context.Background())
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := int32(1), atomic.LoadInt32(&attempts); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("transport error", func(t *testing.T) {
+		var (
+			attempts int32
+			api      = http.NewServeMux()
+			server   = httptest.NewServer(api)
+			service  = New(server.URL, 2, log.NewNopLogger(),
+				WithRetries(3),
+				WithBackoff(time.Millisecond, 10*time.Millisecond),
+			)
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Authorities", func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				// Drop the connection with out a response.
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Fatal(err)
+				}
+				conn.Close()
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(Authorities{}); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		if _, err := service.Authorities(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := int32(2), atomic.LoadInt32(&attempts); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		var (
+			attempts int32
+			api      = http.NewServeMux()
+			server   = httptest.NewServer(api)
+			service  = New(server.URL, 2, log.NewNopLogger(),
+				WithRetries(1),
+				WithBackoff(time.Millisecond, 10*time.Second),
+			)
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Authorities", func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(Authorities{}); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		begin := time.Now()
+		if _, err := service.Authorities(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := true, time.Since(begin) >= time.Second; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("retry after too long", func(t *testing.T) {
+		var (
+			attempts int32
+			api      = http.NewServeMux()
+			server   = httptest.NewServer(api)
+			service  = New(server.URL, 2, log.NewNopLogger(),
+				WithRetries(3),
+				WithBackoff(time.Millisecond, 10*time.Millisecond),
+			)
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Authorities", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+
+		_, err := service.Authorities(context.Background())
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := int32(1), atomic.LoadInt32(&attempts); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, testcase := range []struct {
+		value string
+		wait  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"garbage", 0, false},
+		{"-1", 0, false},
+		{"0", 0, true},
+		{"5", 5 * time.Second, true},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	} {
+		wait, ok := retryAfter(testcase.value)
+		if wait != testcase.wait || ok != testcase.ok {
+			t.Errorf("(%q): want [%v %v], have [%v %v]",
+				testcase.value,
+				testcase.wait, testcase.ok,
+				wait, ok,
+			)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("burst", func(t *testing.T) {
+		l := newLimiter(1, 5)
+
+		// The whole burst should go through with out waiting.
+		begin := time.Now()
+		for i := 0; i < 5; i++ {
+			if err := l.wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if expected, actual := true, time.Since(begin) < 500*time.Millisecond; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		l := newLimiter(20, 1)
+
+		// The first request uses the burst, the rest have to wait 50ms each.
+		begin := time.Now()
+		for i := 0; i < 5; i++ {
+			if err := l.wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if expected, actual := true, time.Since(begin) >= 190*time.Millisecond; expected != actual {
+			t.Errorf("expected: %v, actual: %v (%s)", expected, actual, time.Since(begin))
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		l := newLimiter(0.001, 1)
+
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// The bucket is now empty, so this should give up waiting.
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if expected, actual := context.DeadlineExceeded, l.wait(ctx); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := retryPolicy{
+		retries: 10,
+		base:    10 * time.Millisecond,
+		max:     time.Second,
+	}
+	for attempt := 0; attempt < 100; attempt++ {
+		var (
+			wait = p.backoff(attempt)
+			max  = p.base << uint(attempt)
+		)
+		if attempt >= 32 || max > p.max || max <= 0 {
+			max = p.max
+		}
+		if wait < max/2 || wait > max {
+			t.Errorf("(%d): want [%v, %v], have %v", attempt, max/2, max, wait)
+		}
+	}
+}
+
+func TestRealServiceEstablishmentsPaging(t *testing.T) {
+	t.Parallel()
+
+	// paged returns a handler that pages through total establishments,
+	// calling fail before every page to see if it should fail.
+	paged := func(total int, fail func(page int) bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var (
+				query     = r.URL.Query()
+				page, _   = strconv.Atoi(query.Get("pageNumber"))
+				size, _   = strconv.Atoi(query.Get("pageSize"))
+				pages     = (total + size - 1) / size
+				offset    = (page - 1) * size
+				remaining = total - offset
+			)
+			if fail(page) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if remaining > size {
+				remaining = size
+			}
+
+			res := Establishments{
+				Establishments: make([]Establishment, remaining),
+				Meta: Meta{
+					PageNumber: page,
+					PageSize:   size,
+					TotalCount: total,
+					TotalPages: pages,
+				},
+			}
+			for i := range res.Establishments {
+				res.Establishments[i] = Establishment{
+					Name:   strconv.Itoa(offset + i),
+					Rating: "5",
+				}
+			}
+
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(res); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger(), WithPaging(10, 3))
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Establishments", paged(95, func(int) bool { return false }))
+
+		got, err := service.EstablishmentsForAuthority(context.Background(), "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := 95, len(got); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+		for k, v := range got {
+			if expected, actual := strconv.Itoa(k), v.Name; expected != actual {
+				t.Errorf("expected: %s, actual: %s", expected, actual)
+			}
+		}
+	})
+
+	t.Run("page retried", func(t *testing.T) {
+		var (
+			failed  int32
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger(),
+				WithPaging(10, 3),
+				WithRetries(1),
+				WithBackoff(time.Millisecond, 10*time.Millisecond),
+			)
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Establishments", paged(50, func(page int) bool {
+			return page == 3 && atomic.AddInt32(&failed, 1) == 1
+		}))
+
+		got, err := service.EstablishmentsForAuthority(context.Background(), "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := 50, len(got); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		var (
+			hits    int32
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger(),
+				WithPaging(10, 5),
+				WithRateLimit(50, 1),
+			)
+		)
+		defer server.Close()
+
+		handler := paged(50, func(int) bool { return false })
+		api.HandleFunc("/Establishments", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			handler(w, r)
+		})
+
+		// Every page takes a token, so after the burst the remaining 4 pages
+		// have to wait 20ms each, even though they're requested concurrently.
+		begin := time.Now()
+		got, err := service.EstablishmentsForAuthority(context.Background(), "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := 50, len(got); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := int32(5), atomic.LoadInt32(&hits); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := true, time.Since(begin) >= 75*time.Millisecond; expected != actual {
+			t.Errorf("expected: %v, actual: %v (%s)", expected, actual, time.Since(begin))
+		}
+	})
+
+	t.Run("page retried rate limited", func(t *testing.T) {
+		var (
+			hits, failed int32
+			api          = http.NewServeMux()
+			server       = httptest.NewServer(api)
+			service      = New(server.URL, 2, log.NewNopLogger(),
+				WithPaging(10, 4),
+				WithRetries(2),
+				WithBackoff(time.Millisecond, time.Millisecond),
+				WithRateLimit(50, 1),
+			)
+		)
+		defer server.Close()
+
+		// Fail the middle page twice, while the others are being requested
+		// concurrently.
+		handler := paged(50, func(page int) bool {
+			return page == 3 && atomic.AddInt32(&failed, 1) <= 2
+		})
+		api.HandleFunc("/Establishments", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			handler(w, r)
+		})
+
+		// Both of the retries take a token, so after the burst there are 6
+		// requests left that have to wait 20ms each.
+		begin := time.Now()
+		got, err := service.EstablishmentsForAuthority(context.Background(), "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := 50, len(got); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		for k, v := range got {
+			if expected, actual := strconv.Itoa(k), v.Name; expected != actual {
+				t.Errorf("expected: %s, actual: %s", expected, actual)
+			}
+		}
+		if expected, actual := int32(7), atomic.LoadInt32(&hits); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := true, time.Since(begin) >= 115*time.Millisecond; expected != actual {
+			t.Errorf("expected: %v, actual: %v (%s)", expected, actual, time.Since(begin))
+		}
+	})
+
+	t.Run("page error", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger(), WithPaging(10, 3))
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Establishments", paged(50, func(page int) bool {
+			return page == 4
+		}))
+
+		_, err := service.EstablishmentsForAuthority(context.Background(), "0")
+		if expected, actual := true, err != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var (
+			api     = http.NewServeMux()
+			server  = httptest.NewServer(api)
+			service = New(server.URL, 2, log.NewNopLogger(), WithPaging(0, 1))
+		)
+		defer server.Close()
+
+		api.HandleFunc("/Establishments", func(w http.ResponseWriter, r *http.Request) {
+			if expected, actual := "0", r.URL.Query().Get("pageSize"); expected != actual {
+				t.Errorf("expected: %s, actual: %s", expected, actual)
+			}
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(Establishments{}); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		if _, err := service.EstablishmentsForAuthority(context.Background(), "0"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestRealServiceStreamEstablishmentsForAuthority(t *testing.T) {
+	t.Parallel()
+
+	var (
+		api     = http.NewServeMux()
+		server  = httptest.NewServer(api)
+		service = New(server.URL, 2, log.NewNopLogger(), WithPaging(10, 3))
+	)
+	defer server.Close()
+
+	api.HandleFunc("/Establishments", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("pageNumber"))
+
+		res := Establishments{
+			Establishments: make([]Establishment, 10),
+			Meta: Meta{
+				PageNumber: page,
+				PageSize:   10,
+				TotalCount: 50,
+				TotalPages: 5,
+			},
+		}
+		for i := range res.Establishments {
+			res.Establishments[i] = Establishment{
+				Name:   strconv.Itoa(((page - 1) * 10) + i),
+				Rating: "5",
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	seen := make(map[string]bool)
+	if err := StreamEstablishmentsForAuthority(context.Background(), service, "0", func(e Establishment) error {
+		seen[e.Name] = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := 50, len(seen); expected != actual {
+		t.Errorf("expected: %d, actual: %d", expected, actual)
+	}
 }
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// These are the default durations used for the backoff between retries.
+const (
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+)
+
+// retryPolicy defines how many times and how long to wait between retrying a
+// request.
+type retryPolicy struct {
+	retries int
+	base    time.Duration
+	max     time.Duration
+}
+
+// next returns how long to wait before the next attempt and if there should be
+// a next attempt at all. The wait is an exponential backoff with jitter, unless
+// the API has told us how long to wait via the "Retry-After" header.
+func (p retryPolicy) next(attempt int, resp *http.Response) (time.Duration, bool) {
+	if attempt >= p.retries {
+		return 0, false
+	}
+
+	if resp != nil {
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				// If we're asked to wait longer than we're willing to, then
+				// give up, rather than hammering the API too soon.
+				return wait, wait <= p.max
+			}
+		}
+	}
+
+	return p.backoff(attempt), true
+}
+
+// backoff returns the exponential backoff for the attempt, with "equal jitter"
+// applied; so the wait is always between half and the whole of the backoff.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.max
+	if attempt < 32 {
+		if b := p.base << uint(attempt); b > 0 && b < p.max {
+			d = b
+		}
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// retryable returns true if the status code states that the failure is only
+// temporary.
+func retryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the value of a "Retry-After" header, which can either be
+// a number of seconds or a HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryReason returns a human readable reason as to why a request is retried.
+func retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("status code: %d", resp.StatusCode)
+}
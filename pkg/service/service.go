@@ -1,5 +1,17 @@
 package service
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 const (
 	serviceAPIVersion  = "X-API-Version"
 	serviceContentType = "Content-Type"
@@ -7,19 +19,105 @@ const (
 	contentType = "application/json"
 )
 
+// ErrNotFound is returned when the underlying API doesn't know about the
+// requested entity.
+var ErrNotFound = errors.New("not found")
+
+// StatusError is returned when the underlying API responds with a status code
+// that isn't successful.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("invalid request (status code: %d)", e.Code)
+}
+
+// Temporary returns true if the status code states that the underlying API is
+// failing (5xx) or is overloaded (429), rather than the request being invalid.
+func (e *StatusError) Temporary() bool {
+	return e.Code >= 500 || e.Code == http.StatusTooManyRequests
+}
+
 // Service describes a service that talks to the underlying API
 // The service is envisioned as a interface so that it's possible to abstract
 // the API for mocking during testing.
 type Service interface {
 	// Authorities returns a series of Authorities from the underlying API or it
 	// returns an error if it was not able to request or parse the result.
-	Authorities() ([]Authority, error)
+	// The context is used to cancel the request if the caller goes away.
+	Authorities(context.Context) ([]Authority, error)
 
 	// EstablishmentsForAuthority returns a series of Establishments from the
 	// underlying API or it returns an error if it was not able to request or
 	// parse the result. The Establishments service API takes a Authority
 	// LocalID to select the correct set of establishments for that Authority.
-	EstablishmentsForAuthority(string) ([]Establishment, error)
+	// The context is used to cancel the request if the caller goes away.
+	EstablishmentsForAuthority(context.Context, string) ([]Establishment, error)
+
+	// Establishment returns a single Establishment by it's FHRSID from the
+	// underlying API or it returns an error if it was not able to request or
+	// parse the result. If the Establishment doesn't exist then ErrNotFound is
+	// returned.
+	// The context is used to cancel the request if the caller goes away.
+	Establishment(context.Context, int) (Establishment, error)
+
+	// Regions returns a series of Regions from the underlying API or it
+	// returns an error if it was not able to request or parse the result.
+	// The context is used to cancel the request if the caller goes away.
+	Regions(context.Context) ([]Region, error)
+
+	// Countries returns a series of Countries from the underlying API or it
+	// returns an error if it was not able to request or parse the result.
+	// The context is used to cancel the request if the caller goes away.
+	Countries(context.Context) ([]Country, error)
+
+	// BusinessTypes returns a series of BusinessTypes from the underlying API
+	// or it returns an error if it was not able to request or parse the
+	// result.
+	// The context is used to cancel the request if the caller goes away.
+	BusinessTypes(context.Context) ([]BusinessType, error)
+
+	// SchemeTypes returns a series of SchemeTypes from the underlying API or
+	// it returns an error if it was not able to request or parse the result.
+	// The context is used to cancel the request if the caller goes away.
+	SchemeTypes(context.Context) ([]SchemeType, error)
+
+	// Ratings returns a series of Ratings from the underlying API or it
+	// returns an error if it was not able to request or parse the result.
+	// The context is used to cancel the request if the caller goes away.
+	Ratings(context.Context) ([]Rating, error)
+}
+
+// Streamer describes a service that can stream the establishments for a
+// Authority, rather than returning them all at once. This allows consumers to
+// process large authorities incrementally, with out holding every
+// establishment in memory.
+type Streamer interface {
+	// StreamEstablishmentsForAuthority calls the function for every
+	// Establishment of the Authority. If the function returns an error, then
+	// the stream is stopped and the error is returned.
+	StreamEstablishmentsForAuthority(context.Context, string, func(Establishment) error) error
+}
+
+// StreamEstablishmentsForAuthority calls fn for every Establishment of the
+// Authority. If the service is a Streamer then the establishments are streamed,
+// otherwise they're requested all at once and then iterated over.
+func StreamEstablishmentsForAuthority(ctx context.Context, s Service, localID string, fn func(Establishment) error) error {
+	if streamer, ok := s.(Streamer); ok {
+		return streamer.StreamEstablishmentsForAuthority(ctx, localID, fn)
+	}
+
+	establishments, err := s.EstablishmentsForAuthority(ctx, localID)
+	if err != nil {
+		return err
+	}
+	for _, v := range establishments {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Authorities defines a schema for the JSON payload we require
@@ -32,15 +130,230 @@ type Authority struct {
 	Name               string `json:"Name"`
 	LocalID            int    `json:"LocalAuthorityId"`
 	EstablishmentCount int    `json:"EstablishmentCount"`
+	Region             string `json:"RegionName"`
+}
+
+// Regions defines a schema for the JSON payload we require
+type Regions struct {
+	Regions []Region `json:"regions"`
+}
+
+// Region defines a schema for the JSON from the service
+type Region struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
+// Countries defines a schema for the JSON payload we require
+type Countries struct {
+	Countries []Country `json:"countries"`
+}
+
+// Country defines a schema for the JSON from the service
+type Country struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
+// BusinessTypes defines a schema for the JSON payload we require
+type BusinessTypes struct {
+	BusinessTypes []BusinessType `json:"businessTypes"`
+}
+
+// BusinessType defines a schema for the JSON from the service, the ID is the
+// same as the BusinessTypeID of an Establishment.
+type BusinessType struct {
+	ID   int    `json:"BusinessTypeId"`
+	Name string `json:"BusinessTypeName"`
+}
+
+// SchemeTypes defines a schema for the JSON payload we require
+type SchemeTypes struct {
+	SchemeTypes []SchemeType `json:"schemeTypes"`
+}
+
+// SchemeType defines a schema for the JSON from the service
+type SchemeType struct {
+	ID   int    `json:"schemeTypeid"`
+	Name string `json:"schemeTypeName"`
+	Key  string `json:"schemeTypeKey"`
+}
+
+// Ratings defines a schema for the JSON payload we require
+type Ratings struct {
+	Ratings []Rating `json:"ratings"`
+}
+
+// Rating defines a schema for the JSON from the service, the Name is the same
+// as the Rating of an Establishment.
+type Rating struct {
+	ID           int    `json:"ratingId"`
+	Name         string `json:"ratingName"`
+	Key          string `json:"ratingKey"`
+	SchemeTypeID int    `json:"schemeTypeId"`
 }
 
 // Establishments defines a schema for the JSON payload we require
 type Establishments struct {
 	Establishments []Establishment `json:"establishments"`
+	Meta           Meta            `json:"meta"`
+}
+
+// Meta defines a schema for the paging information of a JSON payload
+type Meta struct {
+	PageNumber int `json:"pageNumber"`
+	PageSize   int `json:"pageSize"`
+	TotalCount int `json:"totalCount"`
+	TotalPages int `json:"totalPages"`
 }
 
 // Establishment defines a schema for the JSON from the service
+// The naming is normalized, so that it's consistent with in the rest of the
+// code i.e. "FHRSID" is the ID and "RatingValue" is the Rating.
 type Establishment struct {
-	Name   string `json:"BusinessName"`
-	Rating string `json:"RatingValue"`
+	ID             int     `json:"FHRSID"`
+	Name           string  `json:"BusinessName"`
+	BusinessType   string  `json:"BusinessType"`
+	BusinessTypeID int     `json:"BusinessTypeID"`
+	Address1       string  `json:"AddressLine1"`
+	Address2       string  `json:"AddressLine2"`
+	Address3       string  `json:"AddressLine3"`
+	Address4       string  `json:"AddressLine4"`
+	PostCode       string  `json:"PostCode"`
+	Rating         string  `json:"RatingValue"`
+	RatingDate     Date    `json:"RatingDate"`
+	Scheme         string  `json:"SchemeType"`
+	Scores         Scores  `json:"scores"`
+	Geocode        Geocode `json:"geocode"`
+}
+
+// Address returns the address lines of the Establishment that aren't empty.
+func (e Establishment) Address() []string {
+	var res []string
+	for _, line := range []string{e.Address1, e.Address2, e.Address3, e.Address4} {
+		if line != "" {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+// Scores defines a schema for the inspection scores of an Establishment. The
+// scores are nil if the Establishment hasn't been scored i.e. it's exempt or
+// awaiting inspection.
+type Scores struct {
+	Hygiene                *int `json:"Hygiene"`
+	Structural             *int `json:"Structural"`
+	ConfidenceInManagement *int `json:"ConfidenceInManagement"`
+}
+
+// Geocode defines the location of an Establishment. Not every Establishment
+// has been located (i.e. mobile traders), in which case it's not valid.
+type Geocode struct {
+	Latitude  float64
+	Longitude float64
+	Valid     bool
+}
+
+// geocode is the schema of the JSON from the service, the coordinates are sent
+// as strings, but numbers are also accepted.
+type geocode struct {
+	Latitude  json.RawMessage `json:"latitude"`
+	Longitude json.RawMessage `json:"longitude"`
+}
+
+// MarshalJSON encodes the geocode in the same schema as the service, with out
+// the quoting of the coordinates.
+func (g Geocode) MarshalJSON() ([]byte, error) {
+	if !g.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	}{g.Latitude, g.Longitude})
+}
+
+// UnmarshalJSON decodes the geocode from the schema of the service. If either
+// of the coordinates is missing or invalid, then the geocode isn't valid.
+func (g *Geocode) UnmarshalJSON(b []byte) error {
+	*g = Geocode{}
+
+	var value *geocode
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	if value == nil {
+		return nil
+	}
+
+	lat, latOK := parseCoordinate(value.Latitude)
+	lng, lngOK := parseCoordinate(value.Longitude)
+	if !latOK || !lngOK || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil
+	}
+	*g = Geocode{
+		Latitude:  lat,
+		Longitude: lng,
+		Valid:     true,
+	}
+	return nil
+}
+
+// parseCoordinate parses a coordinate that's either a string or a number.
+func parseCoordinate(b json.RawMessage) (float64, bool) {
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// dateLayout is the layout of the dates from the service, which are without a
+// timezone.
+const dateLayout = "2006-01-02T15:04:05"
+
+// Date defines a date from the service. The zero value means that there is no
+// date i.e. the Establishment has never been rated.
+type Date struct {
+	time.Time
+}
+
+// MarshalJSON encodes the date in the same layout as the service.
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.Format(dateLayout))
+}
+
+// UnmarshalJSON decodes the date from the layout of the service.
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var value *string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	if value == nil || *value == "" {
+		d.Time = time.Time{}
+		return nil
+	}
+
+	t, err := time.Parse(dateLayout, *value)
+	if err != nil {
+		// Just incase the service starts sending timezones.
+		if t, err = time.Parse(time.RFC3339, *value); err != nil {
+			return err
+		}
+	}
+	d.Time = t
+	return nil
 }
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEstablishmentDecode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rated", func(t *testing.T) {
+		payload := `{
+			"FHRSID": 254719,
+			"LocalAuthorityBusinessID": "PI/000002461",
+			"BusinessName": "Bobs Burgers",
+			"BusinessType": "Restaurant/Cafe/Canteen",
+			"BusinessTypeID": 1,
+			"AddressLine1": "1 High Street",
+			"AddressLine2": "",
+			"AddressLine3": "Leeds",
+			"AddressLine4": "",
+			"PostCode": "LS1 1AA",
+			"Phone": "",
+			"RatingValue": "5",
+			"RatingKey": "fhrs_5_en-gb",
+			"RatingDate": "2017-05-10T00:00:00",
+			"LocalAuthorityCode": "413",
+			"scores": {"Hygiene": 5, "Structural": 0, "ConfidenceInManagement": 10},
+			"SchemeType": "FHRS",
+			"geocode": {"longitude": "-1.5", "latitude": "53.8"}
+		}`
+
+		var got Establishment
+		if err := json.Unmarshal([]byte(payload), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		hygiene, structural, management := 5, 0, 10
+		want := Establishment{
+			ID:             254719,
+			Name:           "Bobs Burgers",
+			BusinessType:   "Restaurant/Cafe/Canteen",
+			BusinessTypeID: 1,
+			Address1:       "1 High Street",
+			Address3:       "Leeds",
+			PostCode:       "LS1 1AA",
+			Rating:         "5",
+			RatingDate:     Date{time.Date(2017, 5, 10, 0, 0, 0, 0, time.UTC)},
+			Scheme:         "FHRS",
+			Scores: Scores{
+				Hygiene:                &hygiene,
+				Structural:             &structural,
+				ConfidenceInManagement: &management,
+			},
+			Geocode: Geocode{
+				Latitude:  53.8,
+				Longitude: -1.5,
+				Valid:     true,
+			},
+		}
+		if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []string{"1 High Street", "Leeds"}, got.Address(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("unrated", func(t *testing.T) {
+		payload := `{
+			"FHRSID": 1,
+			"BusinessName": "Petes Pizza",
+			"RatingValue": "AwaitingInspection",
+			"RatingDate": null,
+			"scores": {"Hygiene": null, "Structural": null, "ConfidenceInManagement": null},
+			"SchemeType": "FHRS"
+		}`
+
+		var got Establishment
+		if err := json.Unmarshal([]byte(payload), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := true, got.RatingDate.IsZero(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := (Scores{}), got.Scores; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := (Geocode{}), got.Geocode; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestGeocode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, want := range []Geocode{
+			Geocode{},
+			Geocode{Latitude: 53.8, Longitude: -1.5, Valid: true},
+		} {
+			b, err := json.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Geocode
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("values", func(t *testing.T) {
+		for _, testcase := range []struct {
+			value string
+			want  Geocode
+		}{
+			{`null`, Geocode{}},
+			{`{"longitude": null, "latitude": null}`, Geocode{}},
+			{`{"longitude": "", "latitude": ""}`, Geocode{}},
+			{`{"longitude": "-1.5"}`, Geocode{}},
+			{`{"longitude": "-1.5", "latitude": "91"}`, Geocode{}},
+			{`{"longitude": "-1.5", "latitude": "53.8"}`, Geocode{Latitude: 53.8, Longitude: -1.5, Valid: true}},
+			{`{"longitude": -1.5, "latitude": 53.8}`, Geocode{Latitude: 53.8, Longitude: -1.5, Valid: true}},
+		} {
+			var got Geocode
+			if err := json.Unmarshal([]byte(testcase.value), &got); err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := testcase.want, got; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("%s: expected: %v, actual: %v", testcase.value, expected, actual)
+			}
+		}
+	})
+}
+
+func TestDate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, want := range []Date{
+			Date{},
+			Date{time.Date(2017, 5, 10, 0, 0, 0, 0, time.UTC)},
+		} {
+			b, err := json.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Date
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("layouts", func(t *testing.T) {
+		for _, testcase := range []struct {
+			value string
+			want  time.Time
+		}{
+			{`null`, time.Time{}},
+			{`""`, time.Time{}},
+			{`"2017-05-10T00:00:00"`, time.Date(2017, 5, 10, 0, 0, 0, 0, time.UTC)},
+			{`"2017-05-10T10:30:00Z"`, time.Date(2017, 5, 10, 10, 30, 0, 0, time.UTC)},
+		} {
+			var got Date
+			if err := json.Unmarshal([]byte(testcase.value), &got); err != nil {
+				t.Errorf("(%s): %v", testcase.value, err)
+				continue
+			}
+			if !got.Equal(testcase.want) {
+				t.Errorf("(%s): want %v, have %v", testcase.value, testcase.want, got)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var got Date
+		if err := json.Unmarshal([]byte(`"10/05/2017"`), &got); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// warmProgressInterval defines how often (in authorities) the progress of the
+// warm up is reported.
+const warmProgressInterval = 25
+
+// Warm prefetches the establishments for every authority, so that a caching
+// service in front of the underlying API has every authority ready to go.
+// The establishments are requested with a bounded number of workers, so that
+// we don't flood the underlying API. Failing to warm an authority doesn't
+// stop the warm up, instead an error is returned once every authority has been
+// tried.
+func Warm(ctx context.Context, service Service, workers int, logger log.Logger) error {
+	begin := time.Now()
+
+	authorities, err := service.Authorities(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error requesting authorities")
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		done     int
+		failed   int
+		total    = len(authorities)
+		localIDs = make(chan string)
+	)
+
+	level.Info(logger).Log("state", "warming", "authorities", total, "workers", workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for localID := range localIDs {
+				_, err := service.EstablishmentsForAuthority(ctx, localID)
+
+				mutex.Lock()
+				done++
+				if err != nil {
+					failed++
+					level.Warn(logger).Log("local_id", localID, "err", err)
+				} else {
+					level.Debug(logger).Log("local_id", localID, "state", "warmed")
+				}
+				if done%warmProgressInterval == 0 || done == total {
+					level.Info(logger).Log("state", "warming", "progress", done, "total", total, "failed", failed)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+loop:
+	for _, authority := range authorities {
+		select {
+		case localIDs <- strconv.Itoa(authority.LocalID):
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(localIDs)
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	level.Info(logger).Log("state", "warmed", "authorities", total, "failed", failed, "duration", time.Since(begin).String())
+
+	if failed > 0 {
+		return errors.Errorf("failed to warm %d of %d authorities", failed, total)
+	}
+	return nil
+}